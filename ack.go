@@ -0,0 +1,200 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"sync"
+	"time"
+)
+
+// acker tracks the results which have not been acknowledged yet
+type acker[T any] struct {
+	ph *Phos[T]
+
+	mu      sync.Mutex
+	id      uint64
+	unacked map[uint64]*delivery[T]
+	// outbox is the redeliveries and dead letters waiting to be emitted by the handle loop
+	outbox []func()
+	closed bool
+}
+
+type delivery[T any] struct {
+	it    *item[T]
+	res   Result[T]
+	timer *time.Timer
+}
+
+// stop the visibility timer of the delivery
+func (d *delivery[T]) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+func newAcker[T any](ph *Phos[T]) *acker[T] {
+	return &acker[T]{
+		ph:      ph,
+		unacked: make(map[uint64]*delivery[T]),
+	}
+}
+
+// Ack confirms that the result has been handled, it will not be redelivered
+// Note: Ack does nothing unless WithAck is enabled
+func (r Result[T]) Ack() {
+	if r.acker != nil {
+		r.acker.ack(r.id)
+	}
+}
+
+// Nack rejects the result, it will be redelivered immediately if requeue is true,
+// otherwise it will be sent to the dead letter (see WithErrDeadLetterFunc)
+// Nack never blocks, the redelivered or dead letter result is emitted by PHOS asynchronously
+// Note: Nack does nothing unless WithAck is enabled
+func (r Result[T]) Nack(requeue bool) {
+	if r.acker == nil {
+		return
+	}
+	if requeue {
+		r.acker.redeliver(r.id)
+		return
+	}
+	r.acker.reject(r.id)
+}
+
+// deliver emits the result and tracks it until it is acknowledged
+func (a *acker[T]) deliver(it *item[T], res Result[T]) {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		if !a.ph.emit(res) {
+			a.ph.abandoned.Add(1)
+		}
+		return
+	}
+	a.id++
+	id := a.id
+	res.acker, res.id = a, id
+	d := &delivery[T]{
+		it:  it,
+		res: res,
+	}
+	// Note: the result is not redelivered without the visibility timeout (the WAL without WithAck)
+	if visibility := a.ph.opts().AckTimeout; visibility > 0 {
+		d.timer = time.AfterFunc(visibility, func() {
+			a.redeliver(id)
+		})
+	}
+	a.unacked[id] = d
+	a.mu.Unlock()
+	if !a.ph.emit(res) {
+		// Note: the result is not received after Shutdown is aborted, it stays unacknowledged
+		a.ph.abandoned.Add(1)
+	}
+}
+
+func (a *acker[T]) ack(id uint64) {
+	a.mu.Lock()
+	d, ok := a.unacked[id]
+	if ok {
+		delete(a.unacked, id)
+		d.stop()
+	}
+	a.mu.Unlock()
+	if ok {
+		a.ph.finish(d.it)
+	}
+}
+
+// redeliver emits the result again, it will be sent to the dead letter if the max redeliveries is exceeded
+func (a *acker[T]) redeliver(id uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	d, ok := a.unacked[id]
+	if !ok || a.closed {
+		return
+	}
+	d.stop()
+	d.res.Redeliveries++
+	if limit := a.ph.opts().MaxRedeliveries; limit > 0 && d.res.Redeliveries > limit {
+		a.dead(id, d)
+		return
+	}
+	if d.timer != nil {
+		d.timer.Reset(a.ph.opts().AckTimeout)
+	}
+	res := d.res
+	a.post(func() {
+		a.ph.emit(res)
+	})
+}
+
+// reject sends the result to the dead letter
+func (a *acker[T]) reject(id uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	d, ok := a.unacked[id]
+	if !ok || a.closed {
+		return
+	}
+	a.dead(id, d)
+}
+
+// dead sends the delivery to the dead letter, it must be called with mu held
+func (a *acker[T]) dead(id uint64, d *delivery[T]) {
+	delete(a.unacked, id)
+	d.stop()
+	a.post(func() {
+		defer a.ph.finish(d.it)
+		options := a.ph.opts()
+		if fn := options.ErrDeadLetterFunc; fn != nil {
+			fn(a.ph.ctx, d.res.Data)
+			return
+		}
+		a.ph.emit(a.ph.result(options, d.res.Data, true, deadLetterError()))
+	})
+}
+
+// post hands fn over to the handle loop, it must be called with mu held
+// Note: Ack, Nack and the visibility timers must not be blocked by emitting to Out,
+// the goroutine calling Nack is usually the one reading Out
+func (a *acker[T]) post(fn func()) {
+	a.outbox = append(a.outbox, fn)
+	a.ph.wake()
+}
+
+// drain runs the functions posted by the redeliveries and the dead letters, it is called by the handle loop
+func (a *acker[T]) drain() {
+	a.mu.Lock()
+	outbox := a.outbox
+	a.outbox = nil
+	a.mu.Unlock()
+	for _, fn := range outbox {
+		fn()
+	}
+}
+
+// close stops the redeliveries and runs the functions which have been posted
+// Note: The results which have not been acknowledged will be replayed if the WAL is enabled
+func (a *acker[T]) close() {
+	a.mu.Lock()
+	a.closed = true
+	for _, d := range a.unacked {
+		d.stop()
+	}
+	a.mu.Unlock()
+	a.drain()
+}
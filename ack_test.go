@@ -0,0 +1,148 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestAck(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithAck(50 * time.Millisecond))
+	defer ph.Close()
+	ph.Append(plusOne)
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Equal(t, 2, res.Data)
+	assert.Zero(t, res.Redeliveries)
+	res.Ack()
+	select {
+	case res = <-ph.Out:
+		t.Fatalf("unexpected redelivery: %v", res)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestAckRedeliver(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithAck(50 * time.Millisecond))
+	defer ph.Close()
+	ph.Append(plusOne)
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Zero(t, res.Redeliveries)
+	// Note:
+	// The result is redelivered after the visibility timeout without Ack
+	res = <-ph.Out
+	assert.Equal(t, 2, res.Data)
+	assert.Equal(t, 1, res.Redeliveries)
+	res.Ack()
+}
+
+func TestNack(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithAck(time.Minute))
+	defer ph.Close()
+	ph.Append(plusOne)
+	ph.In <- 1
+	res := <-ph.Out
+	res.Nack(true)
+	res = <-ph.Out
+	assert.Equal(t, 2, res.Data)
+	assert.Equal(t, 1, res.Redeliveries)
+	res.Nack(false)
+	res = <-ph.Out
+	assert.Equal(t, 2, res.Data)
+	assert.Equal(t, DeadLetterErr, res.Err.Type)
+}
+
+func TestNackBuffered(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithAck(time.Minute))
+	defer ph.Close()
+	ph.Append(plusOne)
+	for i := 1; i <= 3; i++ {
+		ph.In <- i
+	}
+	res := <-ph.Out
+	assert.Eventually(t, func() bool {
+		return len(ph.Out) == 1
+	}, time.Second, time.Millisecond)
+	// Note:
+	// Nack will not be blocked by Out which is full of the next result
+	done := make(chan struct{})
+	go func() {
+		res.Nack(true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Nack is blocked by Out")
+	}
+	var redelivered []int
+	for i := 0; i < 3; i++ {
+		res = <-ph.Out
+		if res.Redeliveries > 0 {
+			redelivered = append(redelivered, res.Data)
+		}
+		res.Ack()
+	}
+	assert.Equal(t, []int{2}, redelivered)
+}
+
+func TestMaxRedeliveries(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	deadC := make(chan any, 1)
+	ph := New[int](WithAck(20*time.Millisecond), WithMaxRedeliveries(1), WithErrDeadLetterFunc(func(ctx context.Context, data any) {
+		deadC <- data
+	}))
+	defer ph.Close()
+	ph.Append(plusOne)
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Zero(t, res.Redeliveries)
+	res = <-ph.Out
+	assert.Equal(t, 1, res.Redeliveries)
+	assert.Equal(t, 2, <-deadC)
+}
+
+func TestAckWAL(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	dir := t.TempDir()
+	wal, err := OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	ph := New[int](WithWAL(wal), WithAck(time.Minute))
+	ph.Append(plusOne)
+	ph.In <- 1
+	ph.In <- 2
+	acked := <-ph.Out
+	acked.Ack()
+	<-ph.Out
+	go ph.Close()
+	assert.False(t, (<-ph.Out).OK)
+	// Note:
+	// The result which is not acknowledged will be replayed
+	wal, err = OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, wal.Pending())
+	assert.Nil(t, wal.Close())
+}
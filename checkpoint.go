@@ -0,0 +1,283 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	_ CheckpointStore = (*FileCheckpointStore)(nil)
+	_ Stage           = (*Window[any])(nil)
+	_ Stage           = (*Dedup[any])(nil)
+)
+
+// Checkpoint is the progress of PHOS
+type Checkpoint struct {
+	// Seq is the sequence number of the last data which has been fully processed together with all the data before it,
+	// the sequence numbers are assigned to the accepted data in order starting from 1
+	Seq uint64
+	// State is the snapshot of the StateStore if it implements Snapshotter
+	State StateSnapshot
+	// Stages is the state of the stages set by WithStage, indexed by name
+	Stages map[string][]byte
+	Time   time.Time
+}
+
+// Stage is implemented by the stages of the handler chain which keep state outside the StateStore (e.g. Window and Dedup)
+type Stage interface {
+	// SnapshotStage returns the encoded state of the stage
+	SnapshotStage() ([]byte, error)
+	// RestoreStage replaces the state of the stage with the encoded state
+	RestoreStage(b []byte) error
+}
+
+// CheckpointStore saves the checkpoints of PHOS, implement it to use another backend
+type CheckpointStore interface {
+	Save(ctx context.Context, cp Checkpoint) error
+	// Load returns the last saved checkpoint, nil if there is no checkpoint
+	Load(ctx context.Context) (*Checkpoint, error)
+}
+
+// FileCheckpointStore saves the checkpoint to a JSON file
+// Note: The state values are decoded as JSON values (e.g. numbers as float64)
+type FileCheckpointStore struct {
+	path string
+}
+
+// NewFileCheckpointStore returns a FileCheckpointStore which saves the checkpoint to path
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{
+		path: path,
+	}
+}
+
+// Save the checkpoint, the file is replaced atomically
+func (s *FileCheckpointStore) Save(_ context.Context, cp Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Load the checkpoint, nil will be returned if the file does not exist
+func (s *FileCheckpointStore) Load(_ context.Context) (*Checkpoint, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(b, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// checkpointer takes the checkpoints in the handle loop
+type checkpointer struct {
+	store  CheckpointStore
+	ticker *time.Ticker
+	reqC   chan chan error
+
+	mu          sync.Mutex
+	last        Checkpoint
+	max         uint64
+	outstanding map[uint64]struct{}
+}
+
+func newCheckpointer(store CheckpointStore, interval time.Duration, resume *Checkpoint) *checkpointer {
+	c := &checkpointer{
+		store:       store,
+		reqC:        make(chan chan error),
+		outstanding: make(map[uint64]struct{}),
+	}
+	if interval > 0 {
+		c.ticker = time.NewTicker(interval)
+	}
+	if resume != nil {
+		c.last = *resume
+		c.max = resume.Seq
+	}
+	return c
+}
+
+// tickC returns nil if the periodic checkpoint is disabled
+func (c *checkpointer) tickC() <-chan time.Time {
+	if c.ticker == nil {
+		return nil
+	}
+	return c.ticker.C
+}
+
+// assign gets the next sequence number and starts it atomically,
+// so that low never passes a sequence number which has been assigned but not started
+func (c *checkpointer) assign(next func() (uint64, error)) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq, err := next()
+	if err != nil {
+		return 0, err
+	}
+	c.outstanding[seq] = struct{}{}
+	c.max = max(c.max, seq)
+	return seq, nil
+}
+
+func (c *checkpointer) start(seq uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outstanding[seq] = struct{}{}
+	c.max = max(c.max, seq)
+}
+
+func (c *checkpointer) finish(seq uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.outstanding, seq)
+}
+
+// low returns the sequence number before the first unfinished one
+func (c *checkpointer) low() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.outstanding) == 0 {
+		return c.max
+	}
+	low := uint64(math.MaxUint64)
+	for seq := range c.outstanding {
+		low = min(low, seq)
+	}
+	return low - 1
+}
+
+// Checkpoint saves a checkpoint now, it blocks until the in-flight data has been handled
+// ErrClosed will be returned after PHOS is closed, ErrNoCheckpoint will be returned unless WithCheckpoint is enabled
+func (ph *Phos[T]) Checkpoint(ctx context.Context) error {
+	if ph.checkpointer == nil {
+		return ErrNoCheckpoint
+	}
+	errC := make(chan error, 1)
+	select {
+	case ph.checkpointer.reqC <- errC:
+	case <-ph.closeC:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-errC:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LastCheckpoint returns the last saved checkpoint, or the one set by WithResume
+func (ph *Phos[T]) LastCheckpoint() Checkpoint {
+	if ph.checkpointer == nil {
+		return Checkpoint{}
+	}
+	ph.checkpointer.mu.Lock()
+	defer ph.checkpointer.mu.Unlock()
+	return ph.checkpointer.last
+}
+
+// resume restores the state and the sequence number from the checkpoint
+func (ph *Phos[T]) resume(cp *Checkpoint) {
+	ph.seq.Store(cp.Seq)
+	if ph.wal != nil {
+		ph.wal.advance(cp.Seq)
+	}
+	if s, ok := ph.opts().StateStore.(Snapshotter); ok && cp.State != nil {
+		s.Restore(cp.State)
+	}
+	for name, stage := range ph.opts().Stages {
+		b, ok := cp.Stages[name]
+		if !ok {
+			continue
+		}
+		// Note: the checkpoint is external input, the stage which can not be restored starts from empty
+		if err := stage.RestoreStage(b); err != nil {
+			ph.reportCheckpoint(fmt.Errorf("stage %s: %w", name, err))
+		}
+	}
+}
+
+// reportCheckpoint reports the error of the checkpoint which is not taken by Checkpoint to ErrCheckpointFunc
+func (ph *Phos[T]) reportCheckpoint(err error) {
+	if fn := ph.opts().ErrCheckpointFunc; err != nil && fn != nil {
+		fn(ph.ctx, err)
+	}
+}
+
+// checkpoint waits for the in-flight data and saves the checkpoint, it must be called in the handle loop
+// Note: The data after Seq may have been handled when PHOS is not idle (e.g. with priority or Ack),
+// it will be handled again after resume (at-least-once)
+func (ph *Phos[T]) checkpoint() error {
+	ph.pending.Wait()
+	cp := Checkpoint{
+		Seq:  ph.checkpointer.low(),
+		Time: time.Now(),
+	}
+	if s, ok := ph.opts().StateStore.(Snapshotter); ok {
+		cp.State = s.Snapshot()
+	}
+	for name, stage := range ph.opts().Stages {
+		b, err := stage.SnapshotStage()
+		if err != nil {
+			return fmt.Errorf("stage %s: %w", name, err)
+		}
+		if cp.Stages == nil {
+			cp.Stages = make(map[string][]byte)
+		}
+		cp.Stages[name] = b
+	}
+	if err := ph.checkpointer.store.Save(ph.opts().Ctx, cp); err != nil {
+		return err
+	}
+	ph.checkpointer.mu.Lock()
+	defer ph.checkpointer.mu.Unlock()
+	ph.checkpointer.last = cp
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// Note:
+// The state values are float64 after the checkpoint is loaded from JSON
+func count(ctx context.Context, data int) (int, error) {
+	state := StateFrom(ctx)
+	v, _ := state.Get("count")
+	var n int
+	switch v := v.(type) {
+	case int:
+		n = v
+	case float64:
+		n = int(v)
+	}
+	state.Put("count", n+1, 0)
+	return n + 1, nil
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	cp, err := store.Load(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, cp)
+	now := time.Now().UTC().Truncate(time.Second)
+	assert.Nil(t, store.Save(context.Background(), Checkpoint{
+		Seq:   3,
+		State: StateSnapshot{"a": {"count": {Value: 1}}},
+		Time:  now,
+	}))
+	cp, err = store.Load(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &Checkpoint{
+		Seq:   3,
+		State: StateSnapshot{"a": {"count": {Value: float64(1)}}},
+		Time:  now,
+	}, cp)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	ph := New[int](WithKeyFunc(parity), WithCheckpoint(store, time.Hour))
+	ph.Append(count)
+	for i := 1; i <= 3; i++ {
+		ph.In <- i
+		<-ph.Out
+	}
+	assert.Nil(t, ph.Checkpoint(context.Background()))
+	assert.Equal(t, uint64(3), ph.LastCheckpoint().Seq)
+	go ph.Close()
+	<-ph.Out
+	assert.ErrorIs(t, ph.Checkpoint(context.Background()), ErrClosed)
+
+	cp, err := store.Load(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), cp.Seq)
+	ph = New[int](WithKeyFunc(parity), WithCheckpoint(store, time.Hour), WithResume(cp))
+	ph.Append(count)
+	// Note:
+	// The count of the odd key is restored from the checkpoint
+	ph.In <- 5
+	assert.Equal(t, 3, (<-ph.Out).Data)
+	go ph.Close()
+	<-ph.Out
+	cp, err = store.Load(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), cp.Seq)
+}
+
+func TestCheckpointWAL(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	dir := t.TempDir()
+	wal, err := OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	// Note:
+	// Simulate a crash after the checkpoint of the data 1 while the done record is lost
+	for i := 1; i <= 2; i++ {
+		_, err = wal.append(i)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, wal.Close())
+	wal, err = OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	ph := New[int](WithWAL(wal), WithCheckpoint(NewFileCheckpointStore(filepath.Join(dir, "checkpoint.json")), 0), WithResume(&Checkpoint{Seq: 1}))
+	ph.Append(plusOne)
+	res := <-ph.Out
+	assert.Equal(t, 3, res.Data)
+	res.Ack()
+	go ph.Close()
+	assert.Empty(t, collect(ph))
+	assert.Equal(t, uint64(2), ph.LastCheckpoint().Seq)
+}
+
+func TestCheckpointLow(t *testing.T) {
+	c := newCheckpointer(nil, 0, &Checkpoint{Seq: 2})
+	assert.Equal(t, uint64(2), c.low())
+	for seq := uint64(3); seq <= 5; seq++ {
+		c.start(seq)
+	}
+	c.finish(3)
+	c.finish(5)
+	assert.Equal(t, uint64(3), c.low())
+	c.finish(4)
+	assert.Equal(t, uint64(5), c.low())
+}
+
+func TestCheckpointConcurrentSend(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	ph := New[int](WithCheckpoint(store, time.Millisecond), WithQueueSize(64))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.Nil(t, ph.SendContext(context.Background(), j))
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		ph.Close()
+	}()
+	n := len(collect(ph))
+	assert.Equal(t, 200, n)
+	assert.Equal(t, uint64(200), ph.LastCheckpoint().Seq)
+}
+
+func TestCheckpointDisabled(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	defer ph.Close()
+	assert.ErrorIs(t, ph.Checkpoint(context.Background()), ErrNoCheckpoint)
+	assert.Zero(t, ph.LastCheckpoint().Seq)
+}
+
+func TestCheckpointStage(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	d := NewDedup[int](strconv.Itoa)
+	w := TumblingWindow[int](10*time.Second, sum, WithEventTime(seconds))
+	ph := New[int](WithCheckpoint(store, time.Hour), WithStage("dedup", d), WithStage("window", w))
+	ph.Append(d.Handler(), w.Handler())
+	for _, data := range []int{1, 2, 2} {
+		ph.In <- data
+	}
+	assert.Eventually(t, func() bool {
+		return d.Duplicates() == 1
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, ph.Checkpoint(context.Background()))
+	// Note:
+	// Simulate a crash after the checkpoint, the open window [1, 2] and the seen keys are saved in the checkpoint
+	cp, err := store.Load(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), cp.Seq)
+	go ph.Close()
+	assert.Equal(t, []int{3}, collect(ph))
+
+	d = NewDedup[int](strconv.Itoa)
+	w = TumblingWindow[int](10*time.Second, sum, WithEventTime(seconds))
+	ph = New[int](WithCheckpoint(store, time.Hour), WithStage("dedup", d), WithStage("window", w), WithResume(cp))
+	ph.Append(d.Handler(), w.Handler())
+	ph.In <- 2
+	ph.In <- 5
+	go ph.Close()
+	assert.Equal(t, []int{1 + 2 + 5}, collect(ph))
+	assert.Equal(t, uint64(1), d.Duplicates())
+}
+
+type failCheckpointStore struct{}
+
+func (failCheckpointStore) Save(context.Context, Checkpoint) error {
+	return errors.New("save error")
+}
+
+func (failCheckpointStore) Load(context.Context) (*Checkpoint, error) {
+	return nil, nil
+}
+
+func TestErrCheckpointFunc(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	errC := make(chan error, 1)
+	ph := New[int](WithCheckpoint(failCheckpointStore{}, time.Millisecond), WithErrCheckpointFunc(func(_ context.Context, err error) {
+		select {
+		case errC <- err:
+		default:
+		}
+	}))
+	// Note:
+	// The error of the periodic checkpoint is reported to ErrCheckpointFunc
+	select {
+	case err := <-errC:
+		assert.EqualError(t, err, "save error")
+	case <-time.After(time.Second):
+		t.Fatal("the checkpoint error is not reported")
+	}
+	assert.EqualError(t, ph.Checkpoint(context.Background()), "save error")
+	go ph.Close()
+	<-ph.Out
+}
+
+func TestCheckpointStageCorrupt(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	var errs []error
+	d := NewDedup[int](strconv.Itoa)
+	cp := &Checkpoint{Stages: map[string][]byte{"dedup": []byte("corrupt")}}
+	// Note:
+	// The stage which can not be restored is reported and starts from empty
+	ph := New[int](WithStage("dedup", d), WithResume(cp), WithErrCheckpointFunc(func(_ context.Context, err error) {
+		errs = append(errs, err)
+	}))
+	ph.Append(d.Handler())
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "stage dedup")
+	ph.In <- 1
+	assert.Equal(t, 1, (<-ph.Out).Data)
+	go ph.Close()
+	<-ph.Out
+}
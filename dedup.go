@@ -0,0 +1,189 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var defaultDedupOptions = DedupOptions{
+	Window:   0,
+	Capacity: 10000,
+	Flag:     false,
+}
+
+// DedupOption for Dedup
+type DedupOption func(o *DedupOptions)
+
+// DedupOptions for Dedup
+type DedupOptions struct {
+	Window   time.Duration
+	Capacity int
+	Flag     bool
+}
+
+// WithDedupWindow will set the time window in which the data with the same key is duplicated (no limit if <= 0)
+func WithDedupWindow(window time.Duration) DedupOption {
+	return func(o *DedupOptions) {
+		o.Window = window
+	}
+}
+
+// WithDedupCapacity will set the max number of keys to remember, the least recently seen key will be evicted
+func WithDedupCapacity(capacity int) DedupOption {
+	return func(o *DedupOptions) {
+		o.Capacity = capacity
+	}
+}
+
+// WithDedupFlag will make Dedup return a DuplicateErr Error for duplicates instead of dropping them silently
+func WithDedupFlag() DedupOption {
+	return func(o *DedupOptions) {
+		o.Flag = true
+	}
+}
+
+// Dedup is a stage of the handler chain which drops the data seen before by the idempotency key
+// Dedup implements Stage, the seen keys will be saved in the checkpoint if it is set by WithStage
+type Dedup[T any] struct {
+	key     func(data T) string
+	options *DedupOptions
+
+	mu         sync.Mutex
+	lru        *list.List
+	seen       map[string]*list.Element
+	duplicates atomic.Uint64
+}
+
+type seenKey struct {
+	key  string
+	seen time.Time
+}
+
+// dedupState is the encoded seen key of Dedup
+type dedupState struct {
+	Key  string
+	Seen time.Time
+}
+
+// NewDedup returns a Dedup which identifies data by key
+func NewDedup[T any](key func(data T) string, opts ...DedupOption) *Dedup[T] {
+	options := &DedupOptions{
+		Window:   defaultDedupOptions.Window,
+		Capacity: defaultDedupOptions.Capacity,
+		Flag:     defaultDedupOptions.Flag,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &Dedup[T]{
+		key:     key,
+		options: options,
+		lru:     list.New(),
+		seen:    make(map[string]*list.Element),
+	}
+}
+
+// SnapshotStage encodes the seen keys from the least recently seen as JSON
+func (d *Dedup[T]) SnapshotStage() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state := make([]dedupState, 0, d.lru.Len())
+	for e := d.lru.Back(); e != nil; e = e.Prev() {
+		s := e.Value.(*seenKey)
+		state = append(state, dedupState{
+			Key:  s.key,
+			Seen: s.seen,
+		})
+	}
+	return json.Marshal(state)
+}
+
+// RestoreStage replaces the seen keys with the encoded ones
+func (d *Dedup[T]) RestoreStage(b []byte) error {
+	var state []dedupState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lru.Init()
+	d.seen = make(map[string]*list.Element)
+	for _, s := range state {
+		d.seen[s.Key] = d.lru.PushFront(&seenKey{
+			key:  s.Key,
+			seen: s.Seen,
+		})
+		if d.options.Capacity > 0 && d.lru.Len() > d.options.Capacity {
+			oldest := d.lru.Back()
+			d.lru.Remove(oldest)
+			delete(d.seen, oldest.Value.(*seenKey).key)
+		}
+	}
+	return nil
+}
+
+// Duplicates returns the number of duplicates found
+func (d *Dedup[T]) Duplicates() uint64 {
+	return d.duplicates.Load()
+}
+
+// Handler returns the Handler of Dedup to be appended to PHOS
+// The duplicates will be dropped with ErrSkip, or returned with DuplicateErr if WithDedupFlag is enabled
+func (d *Dedup[T]) Handler() Handler[T] {
+	return func(_ context.Context, data T) (T, error) {
+		if !d.check(d.key(data), time.Now()) {
+			return data, nil
+		}
+		d.duplicates.Add(1)
+		if d.options.Flag {
+			return data, duplicateError()
+		}
+		return data, ErrSkip
+	}
+}
+
+// check records the key and reports whether it is a duplicate
+func (d *Dedup[T]) check(key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.seen[key]; ok {
+		s := e.Value.(*seenKey)
+		if d.options.Window <= 0 || now.Sub(s.seen) < d.options.Window {
+			d.lru.MoveToFront(e)
+			return true
+		}
+		// Note: the key is out of the window, it is seen for the first time again
+		s.seen = now
+		d.lru.MoveToFront(e)
+		return false
+	}
+	d.seen[key] = d.lru.PushFront(&seenKey{
+		key:  key,
+		seen: now,
+	})
+	if d.options.Capacity > 0 && d.lru.Len() > d.options.Capacity {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.seen, oldest.Value.(*seenKey).key)
+	}
+	return false
+}
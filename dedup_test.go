@@ -0,0 +1,72 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestDedup(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(8))
+	d := NewDedup[int](strconv.Itoa)
+	ph.Append(d.Handler(), plusOne)
+	for _, data := range []int{1, 2, 1, 3, 2} {
+		ph.In <- data
+	}
+	go ph.Close()
+	// Note:
+	// The duplicates are dropped without results
+	assert.Equal(t, []int{2, 3, 4}, collect(ph))
+	assert.Equal(t, uint64(2), d.Duplicates())
+}
+
+func TestDedupFlag(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	defer ph.Close()
+	d := NewDedup[int](strconv.Itoa, WithDedupFlag())
+	ph.Append(d.Handler(), plusOne)
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Equal(t, 2, res.Data)
+	assert.Nil(t, res.Err)
+	ph.In <- 1
+	res = <-ph.Out
+	assert.Equal(t, 1, res.Data)
+	assert.Equal(t, DuplicateErr, res.Err.Type)
+}
+
+func TestDedupWindowAndCapacity(t *testing.T) {
+	d := NewDedup[int](strconv.Itoa, WithDedupWindow(time.Minute), WithDedupCapacity(2))
+	now := time.Now()
+	assert.False(t, d.check("1", now))
+	assert.True(t, d.check("1", now.Add(time.Second)))
+	// Note:
+	// The key is seen for the first time again after the window
+	assert.False(t, d.check("1", now.Add(2*time.Minute)))
+	assert.False(t, d.check("2", now))
+	assert.False(t, d.check("3", now))
+	// Note:
+	// The key 1 has been evicted by the capacity
+	assert.False(t, d.check("1", now.Add(2*time.Minute)))
+	assert.True(t, d.check("3", now))
+}
@@ -15,9 +15,41 @@
 
 package phos
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	_ error = (*Error)(nil)
+	_ error = (*ShutdownError)(nil)
+)
 
-var _ error = (*Error)(nil)
+var (
+	// ErrClosed is returned when sending data to or modifying a closed PHOS
+	ErrClosed = errors.New("phos error closed")
+	// ErrFull is returned by TrySend when PHOS can not accept data at the moment
+	ErrFull = errors.New("phos error full")
+	// ErrOutOfRange is returned by TryDelete when there is no handler at the index
+	ErrOutOfRange = errors.New("phos error index out of range")
+	// ErrSkip can be returned by handlers to consume the data without delivering a result to Out
+	ErrSkip = errors.New("phos error skip")
+	// ErrNoPrevious is returned by Rollback when there is no handler chain to roll back to
+	ErrNoPrevious = errors.New("phos error no previous handler chain")
+	// ErrImmutableOption is returned by Update when an option which can only be set by New is changed
+	ErrImmutableOption = errors.New("phos error immutable option")
+	// ErrTimeout is wrapped by the TimeoutErr Error when the timeout of the handler chain is exceeded
+	ErrTimeout = errors.New("phos error timeout")
+	// ErrDeadline is wrapped by the TimeoutErr Error when the deadline of the data is exceeded, see WithItemDeadline
+	ErrDeadline = errors.New("phos error item deadline")
+	// ErrChainChanged is wrapped by the HandlerErr Error when the data aggregated by Window can not be handled
+	// because the handler chain has been changed by Swap, Rollback or Delete
+	ErrChainChanged = errors.New("phos error handler chain changed")
+	// ErrNoCheckpoint is returned by Checkpoint when WithCheckpoint is not enabled
+	ErrNoCheckpoint = errors.New("phos error checkpoint is not enabled")
+	// ErrCorrupt is returned by OpenWAL when a record which is not the torn tail of the WAL is corrupted
+	ErrCorrupt = errors.New("phos error wal corrupt")
+)
 
 // Error for PHOS
 // Error implements the error interface
@@ -31,6 +63,28 @@ func (e *Error) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ShutdownError is returned by Shutdown when the context is done before PHOS has been drained
+type ShutdownError struct {
+	Err error
+	// Abandoned is the number of data which have not been handled completely
+	Abandoned int
+}
+
+// Error returns the error string
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("phos error shutdown: %d abandoned: %v", e.Abandoned, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
 // ErrorType for PHOS Error
 type ErrorType uint64
 
@@ -39,6 +93,10 @@ const (
 	TimeoutErr
 	HandlerErr
 	CtxErr
+	RateLimitErr
+	DroppedErr
+	DuplicateErr
+	DeadLetterErr
 )
 
 func newError(err error, t ErrorType) *Error {
@@ -48,8 +106,9 @@ func newError(err error, t ErrorType) *Error {
 	}
 }
 
-func timeoutError() *Error {
-	return newError(errors.New("phos error timeout"), TimeoutErr)
+// timeoutError wraps ErrTimeout or ErrDeadline
+func timeoutError(cause error) *Error {
+	return newError(cause, TimeoutErr)
 }
 
 func handlerError(err error) *Error {
@@ -59,3 +118,26 @@ func handlerError(err error) *Error {
 func ctxError(err error) *Error {
 	return newError(err, CtxErr)
 }
+
+func rateLimitError() *Error {
+	return newError(errors.New("phos error rate limit"), RateLimitErr)
+}
+
+func droppedError() *Error {
+	return newError(errors.New("phos error dropped"), DroppedErr)
+}
+
+func duplicateError() *Error {
+	return newError(errors.New("phos error duplicate"), DuplicateErr)
+}
+
+func deadLetterError() *Error {
+	return newError(errors.New("phos error dead letter"), DeadLetterErr)
+}
+
+func shutdownError(err error, abandoned int) *ShutdownError {
+	return &ShutdownError{
+		Err:       err,
+		Abandoned: abandoned,
+	}
+}
@@ -24,9 +24,12 @@ import (
 
 func TestNewError(t *testing.T) {
 	// TimeoutError
-	timeoutErr := timeoutError()
+	timeoutErr := timeoutError(ErrTimeout)
 	assert.Equal(t, TimeoutErr, timeoutErr.Type)
 	assert.Equal(t, "phos error timeout", timeoutErr.Err.Error())
+	deadlineErr := timeoutError(ErrDeadline)
+	assert.Equal(t, TimeoutErr, deadlineErr.Type)
+	assert.ErrorIs(t, deadlineErr, ErrDeadline)
 	// HandleError
 	handleErr := handlerError(errors.New("handle error"))
 	assert.Equal(t, HandlerErr, handleErr.Type)
@@ -35,4 +38,20 @@ func TestNewError(t *testing.T) {
 	ctxErr := ctxError(errors.New("ctx error"))
 	assert.Equal(t, CtxErr, ctxErr.Type)
 	assert.Equal(t, "ctx error", ctxErr.Err.Error())
+	// RateLimitError
+	rateLimitErr := rateLimitError()
+	assert.Equal(t, RateLimitErr, rateLimitErr.Type)
+	assert.Equal(t, "phos error rate limit", rateLimitErr.Err.Error())
+	// DroppedError
+	droppedErr := droppedError()
+	assert.Equal(t, DroppedErr, droppedErr.Type)
+	assert.Equal(t, "phos error dropped", droppedErr.Err.Error())
+	// DuplicateError
+	duplicateErr := duplicateError()
+	assert.Equal(t, DuplicateErr, duplicateErr.Type)
+	assert.Equal(t, "phos error duplicate", duplicateErr.Err.Error())
+	// DeadLetterError
+	deadLetterErr := deadLetterError()
+	assert.Equal(t, DeadLetterErr, deadLetterErr.Type)
+	assert.Equal(t, "phos error dead letter", deadLetterErr.Err.Error())
 }
@@ -0,0 +1,95 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket which is refilled at rate tokens per second up to burst tokens
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// RateLimitHandler limits the invocations of the handler to rate per second with burst
+// The waiting counts against the timeout of the handler chain,
+// a RateLimitErr Error will be returned without waiting if the token will not be available before the deadline
+// Note: It panics if rate is not positive
+func RateLimitHandler[T any](handler Handler[T], rate float64, burst int) Handler[T] {
+	if !(rate > 0) {
+		panic("phos: RateLimitHandler requires positive rate")
+	}
+	l := newLimiter(rate, burst)
+	return func(ctx context.Context, input T) (T, error) {
+		if err := l.wait(ctx); err != nil {
+			return input, err
+		}
+		return handler(ctx, input)
+	}
+}
+
+// wait blocks until a token is available or ctx is done
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		// Note: give back the token which will not be used
+		l.tokens++
+		l.mu.Unlock()
+		return rateLimitError()
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(10, 2)
+	ctx := context.Background()
+	now := time.Now()
+	assert.Nil(t, l.wait(ctx))
+	assert.Nil(t, l.wait(ctx))
+	assert.Less(t, time.Since(now), 50*time.Millisecond)
+	// Note:
+	// The burst has been used up, the third one will wait for about 100ms
+	assert.Nil(t, l.wait(ctx))
+	assert.GreaterOrEqual(t, time.Since(now), 80*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := l.wait(ctx)
+	var phErr *Error
+	assert.True(t, errors.As(err, &phErr))
+	assert.Equal(t, RateLimitErr, phErr.Type)
+	assert.Equal(t, "phos error rate limit", phErr.Error())
+}
+
+func TestRateLimitOption(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithRateLimit(1, 1), WithTimeout(100*time.Millisecond))
+	defer ph.Close()
+	ph.Append(plusOne)
+	ph.In <- 10
+	ph.In <- 20
+	res1 := <-ph.Out
+	res2 := <-ph.Out
+	assert.Equal(t, 11, res1.Data)
+	assert.Nil(t, res1.Err)
+	assert.Equal(t, 20, res2.Data)
+	assert.Equal(t, RateLimitErr, res2.Err.Type)
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithTimeout(100 * time.Millisecond))
+	defer ph.Close()
+	ph.Append(plusOne, RateLimitHandler[int](plusThree, 1, 1))
+	ph.In <- 10
+	ph.In <- 20
+	res1 := <-ph.Out
+	res2 := <-ph.Out
+	assert.Equal(t, 14, res1.Data)
+	assert.Nil(t, res1.Err)
+	assert.Equal(t, 21, res2.Data)
+	assert.Equal(t, RateLimitErr, res2.Err.Type)
+}
+
+func TestRateLimitHandlerInvalid(t *testing.T) {
+	assert.Panics(t, func() { RateLimitHandler[int](plusOne, 0, 1) })
+	assert.Panics(t, func() { RateLimitHandler[int](plusOne, -1, 1) })
+	assert.Panics(t, func() { RateLimitHandler[int](plusOne, math.NaN(), 1) })
+}
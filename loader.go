@@ -0,0 +1,401 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HandlerFactory creates a Handler with the params of the pipeline definition
+type HandlerFactory[T any] func(params map[string]any) (Handler[T], error)
+
+// Registry maps handler names to HandlerFactory for Load
+type Registry[T any] struct {
+	mu        sync.RWMutex
+	factories map[string]HandlerFactory[T]
+}
+
+// LoadError is an error of the pipeline definition at Line and Column
+// Note: Column is 0 for the syntax errors, and Line is 0 as well if the parser does not report it
+type LoadError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("phos error load line %d column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+var registries sync.Map
+
+// NewRegistry returns an empty Registry
+func NewRegistry[T any]() *Registry[T] {
+	return &Registry[T]{
+		factories: make(map[string]HandlerFactory[T]),
+	}
+}
+
+// DefaultRegistry returns the global Registry of the data type T
+func DefaultRegistry[T any]() *Registry[T] {
+	key := reflect.TypeOf((*T)(nil)).Elem()
+	r, _ := registries.LoadOrStore(key, NewRegistry[T]())
+	return r.(*Registry[T])
+}
+
+// Register the factory to the global Registry of the data type T
+func Register[T any](name string, factory HandlerFactory[T]) {
+	DefaultRegistry[T]().Register(name, factory)
+}
+
+// Load builds PHOS from the pipeline definition with the global Registry of the data type T, see Registry.Load
+func Load[T any](doc []byte, opts ...Option) (*Phos[T], error) {
+	return DefaultRegistry[T]().Load(doc, opts...)
+}
+
+// Register the factory with name, the factory registered before with the same name will be replaced
+func (r *Registry[T]) Register(name string, factory HandlerFactory[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
+
+// Names returns the registered names in order
+func (r *Registry[T]) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load builds PHOS from the pipeline definition in YAML or JSON, opts will be applied after the options of the definition
+//
+//	options:
+//	  timeout: 5s
+//	  queue_size: 8
+//	handlers:
+//	  - name: add
+//	    params: {n: 1}
+//	    timeout: 100ms
+//	    retries: 2
+//
+// The supported options are timeout, zero, close_out, pause_in_flight, rate, burst, queue_size,
+// overflow (block, reject, drop_newest, drop_oldest or drop_lowest), aging and workers
+// A handler is retried on error for retries times, and its execution is limited by its own timeout if set
+// A LoadError will be returned if the definition is invalid
+func (r *Registry[T]) Load(doc []byte, opts ...Option) (*Phos[T], error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, syntaxError(err)
+	}
+	if len(root.Content) == 0 {
+		return nil, &LoadError{Line: 1, Column: 1, Msg: "empty definition"}
+	}
+	node := root.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return nil, loadError(node, "expect a mapping")
+	}
+	var (
+		options  []Option
+		handlers []Handler[T]
+	)
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		var err error
+		switch key.Value {
+		case "options":
+			options, err = loadOptions(value)
+		case "handlers":
+			handlers, err = r.loadHandlers(value)
+		default:
+			err = loadError(key, "unknown field %q", key.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	ph := New[T](append(options, opts...)...)
+	ph.Append(handlers...)
+	return ph, nil
+}
+
+func loadOptions(node *yaml.Node) ([]Option, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, loadError(node, "options expect a mapping")
+	}
+	var (
+		opts      []Option
+		rate      float64
+		burst     int
+		rateNode  *yaml.Node
+		burstNode *yaml.Node
+	)
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		var (
+			opt Option
+			err error
+		)
+		switch key.Value {
+		case "timeout":
+			var d time.Duration
+			d, err = loadDuration(value)
+			opt = WithTimeout(d)
+		case "zero":
+			opt, err = loadFlag(value, WithZero())
+		case "close_out":
+			opt, err = loadFlag(value, WithCloseOut())
+		case "pause_in_flight":
+			opt, err = loadFlag(value, WithPauseInFlight())
+		case "rate":
+			rate, err = loadScalar(value, func(s string) (float64, error) {
+				return strconv.ParseFloat(s, 64)
+			})
+			if err == nil && !(rate > 0) {
+				err = loadError(value, "rate expects a positive number")
+			}
+			rateNode = value
+		case "burst":
+			burst, err = loadScalar(value, strconv.Atoi)
+			burstNode = key
+		case "queue_size":
+			var n int
+			n, err = loadScalar(value, strconv.Atoi)
+			opt = WithQueueSize(n)
+		case "workers":
+			var n int
+			n, err = loadScalar(value, strconv.Atoi)
+			opt = WithWorkers(n)
+		case "overflow":
+			var policy OverflowPolicy
+			policy, err = loadScalar(value, parseOverflow)
+			opt = WithOverflow(policy)
+		case "aging":
+			var d time.Duration
+			d, err = loadDuration(value)
+			opt = WithAging(d)
+		default:
+			err = loadError(key, "unknown option %q", key.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+	}
+	if burstNode != nil && rateNode == nil {
+		return nil, loadError(burstNode, "burst expects rate")
+	}
+	if rateNode != nil {
+		opts = append(opts, WithRateLimit(rate, burst))
+	}
+	return opts, nil
+}
+
+func parseOverflow(s string) (OverflowPolicy, error) {
+	switch s {
+	case "block":
+		return OverflowBlock, nil
+	case "reject":
+		return OverflowReject, nil
+	case "drop_newest":
+		return OverflowDropNewest, nil
+	case "drop_oldest":
+		return OverflowDropOldest, nil
+	case "drop_lowest":
+		return OverflowDropLowest, nil
+	default:
+		return OverflowBlock, errors.New("unknown overflow policy")
+	}
+}
+
+func (r *Registry[T]) loadHandlers(node *yaml.Node) ([]Handler[T], error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, loadError(node, "handlers expect a sequence")
+	}
+	handlers := make([]Handler[T], 0, len(node.Content))
+	for _, n := range node.Content {
+		handler, err := r.loadHandler(n)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, handler)
+	}
+	return handlers, nil
+}
+
+func (r *Registry[T]) loadHandler(node *yaml.Node) (Handler[T], error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, loadError(node, "handler expects a mapping")
+	}
+	var (
+		name    *yaml.Node
+		params  map[string]any
+		timeout time.Duration
+		retries int
+	)
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		var err error
+		switch key.Value {
+		case "name":
+			if value.Kind != yaml.ScalarNode {
+				err = loadError(value, "name expects a string")
+			}
+			name = value
+		case "params":
+			if value.Kind != yaml.MappingNode {
+				err = loadError(value, "params expect a mapping")
+			} else if err = value.Decode(&params); err != nil {
+				err = loadError(value, "%v", err)
+			}
+		case "timeout":
+			timeout, err = loadDuration(value)
+		case "retries":
+			retries, err = loadScalar(value, strconv.Atoi)
+		default:
+			err = loadError(key, "unknown field %q", key.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if name == nil {
+		return nil, loadError(node, "handler expects a name")
+	}
+	r.mu.RLock()
+	factory, ok := r.factories[name.Value]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, loadError(name, "unknown handler %q", name.Value)
+	}
+	handler, err := factory(params)
+	if err != nil {
+		return nil, loadError(node, "handler %q: %v", name.Value, err)
+	}
+	if timeout > 0 {
+		handler = withHandlerTimeout(handler, timeout)
+	}
+	if retries > 0 {
+		handler = withRetries(handler, retries)
+	}
+	return handler, nil
+}
+
+func loadScalar[V any](node *yaml.Node, parse func(s string) (V, error)) (V, error) {
+	if node.Kind != yaml.ScalarNode {
+		return *new(V), loadError(node, "expect a scalar")
+	}
+	v, err := parse(node.Value)
+	if err != nil {
+		return v, loadError(node, "invalid value %q", node.Value)
+	}
+	return v, nil
+}
+
+// loadFlag returns opt if the value is true
+func loadFlag(node *yaml.Node, opt Option) (Option, error) {
+	b, err := loadScalar(node, strconv.ParseBool)
+	if err != nil || !b {
+		return nil, err
+	}
+	return opt, nil
+}
+
+func loadDuration(node *yaml.Node) (time.Duration, error) {
+	d, err := loadScalar(node, time.ParseDuration)
+	if err == nil && d < 0 {
+		return 0, loadError(node, "negative duration %q", node.Value)
+	}
+	return d, err
+}
+
+var syntaxLine = regexp.MustCompile(`line (\d+): (.*)$`)
+
+// syntaxError converts the error of the YAML (or JSON) parser to LoadError with the line reported by the parser
+func syntaxError(err error) *LoadError {
+	msg := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+	}
+	loadErr := &LoadError{
+		Msg: strings.TrimPrefix(msg, "yaml: "),
+	}
+	if m := syntaxLine.FindStringSubmatch(msg); m != nil {
+		loadErr.Line, _ = strconv.Atoi(m[1])
+		loadErr.Msg = m[2]
+	}
+	return loadErr
+}
+
+func loadError(node *yaml.Node, format string, args ...any) *LoadError {
+	return &LoadError{
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// withHandlerTimeout limits the execution of the handler, the handler should return when ctx is done
+func withHandlerTimeout[T any](handler Handler[T], timeout time.Duration) Handler[T] {
+	return func(ctx context.Context, data T) (T, error) {
+		cctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		type result struct {
+			data T
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			output, err := handler(cctx, data)
+			done <- result{output, err}
+		}()
+		select {
+		case res := <-done:
+			return res.data, res.err
+		case <-cctx.Done():
+			return data, cctx.Err()
+		}
+	}
+}
+
+// withRetries executes the handler again with the same input on error for at most retries times
+func withRetries[T any](handler Handler[T], retries int) Handler[T] {
+	return func(ctx context.Context, data T) (T, error) {
+		output, err := handler(ctx, data)
+		for i := 0; i < retries && err != nil && !errors.Is(err, ErrSkip) && ctx.Err() == nil; i++ {
+			output, err = handler(ctx, data)
+		}
+		return output, err
+	}
+}
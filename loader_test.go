@@ -0,0 +1,137 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func newTestRegistry() *Registry[int] {
+	r := NewRegistry[int]()
+	r.Register("add", func(params map[string]any) (Handler[int], error) {
+		n, ok := params["n"].(int)
+		if !ok {
+			return nil, errors.New("n expects an int")
+		}
+		return func(_ context.Context, data int) (int, error) {
+			return data + n, nil
+		}, nil
+	})
+	r.Register("flaky", func(params map[string]any) (Handler[int], error) {
+		failures := 2
+		return func(_ context.Context, data int) (int, error) {
+			if failures > 0 {
+				failures--
+				return data, errors.New("flaky")
+			}
+			return data, nil
+		}, nil
+	})
+	r.Register("sleep", func(params map[string]any) (Handler[int], error) {
+		return plusOneWithCtxSleep, nil
+	})
+	return r
+}
+
+func TestLoad(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	doc := `
+options:
+  timeout: 5s
+  queue_size: 8
+  overflow: drop_oldest
+  rate: 100
+  burst: 10
+handlers:
+  - name: add
+    params: {n: 2}
+  - name: flaky
+    retries: 2
+`
+	ph, err := newTestRegistry().Load([]byte(doc))
+	assert.Nil(t, err)
+	defer ph.Close()
+	assert.Equal(t, 2, ph.Len())
+	assert.Equal(t, 5*time.Second, ph.Options().Timeout)
+	assert.Equal(t, 8, ph.Options().QueueSize)
+	assert.Equal(t, OverflowDropOldest, ph.Options().Overflow)
+	assert.Equal(t, float64(100), ph.Options().Rate)
+	assert.Equal(t, 10, ph.Options().Burst)
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Equal(t, 3, res.Data)
+	assert.Nil(t, res.Err)
+}
+
+func TestLoadJSON(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	doc := `{"handlers": [{"name": "sleep", "timeout": "10ms"}]}`
+	ph, err := newTestRegistry().Load([]byte(doc), WithZero())
+	assert.Nil(t, err)
+	defer ph.Close()
+	assert.True(t, ph.Options().Zero)
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Equal(t, HandlerErr, res.Err.Type)
+	assert.ErrorIs(t, res.Err, context.DeadlineExceeded)
+}
+
+func TestLoadError(t *testing.T) {
+	for _, tc := range []struct {
+		doc    string
+		line   int
+		column int
+	}{
+		{doc: "options:\n  timeout: 5x\n", line: 2, column: 12},
+		{doc: "options:\n  unknown: 1\n", line: 2, column: 3},
+		{doc: "handlers:\n  - name: add\n    params: {n: 1}\n  - name: missing\n", line: 4, column: 11},
+		{doc: "handlers:\n  - name: add\n    params: {n: one}\n", line: 2, column: 5},
+		{doc: "handlers:\n  - params: {n: 1}\n", line: 2, column: 5},
+		{doc: "{\"options\": {\"overflow\": \"drop_all\"}}", line: 1, column: 26},
+		{doc: "options: [timeout\n", line: 1, column: 0},
+		{doc: "options:\n  timeout: 1s\n bad: x\n", line: 2, column: 0},
+		{doc: "options:\n  burst: 2\n", line: 2, column: 3},
+		{doc: "options:\n  rate: 0\n", line: 2, column: 9},
+		{doc: "options:\n  timeout: -1s\n", line: 2, column: 12},
+		{doc: "handlers:\n  - name: add\n    timeout: -1s\n", line: 3, column: 14},
+	} {
+		_, err := newTestRegistry().Load([]byte(tc.doc))
+		var loadErr *LoadError
+		if assert.ErrorAs(t, err, &loadErr, tc.doc) {
+			assert.Equal(t, tc.line, loadErr.Line, tc.doc)
+			assert.Equal(t, tc.column, loadErr.Column, tc.doc)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	Register[int]("register-test-plus-one", func(map[string]any) (Handler[int], error) {
+		return plusOne, nil
+	})
+	assert.Contains(t, DefaultRegistry[int]().Names(), "register-test-plus-one")
+	ph, err := Load[int]([]byte("handlers:\n  - name: register-test-plus-one\n"))
+	assert.Nil(t, err)
+	defer ph.Close()
+	ph.In <- 1
+	assert.Equal(t, 2, (<-ph.Out).Data)
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import "reflect"
+
+// Merged is the Result of Merge with the index of its source PHOS
+type Merged[T any] struct {
+	Result[T]
+	// Source is the index of the PHOS in the arguments of Merge
+	Source int
+}
+
+// Merge multiplexes the Out of multiple PHOS into one channel
+// The sources are scheduled in a round-robin way, so a busy source can not starve the others
+// The terminal result (OK == false) of each source will be delivered as well,
+// and the returned channel will be closed after all sources have emitted their terminal result
+// Note: You should not receive from the Out of the merged PHOS manually
+func Merge[T any](phs ...*Phos[T]) <-chan Merged[T] {
+	out := make(chan Merged[T], 1)
+	go merge(phs, out)
+	return out
+}
+
+func merge[T any](phs []*Phos[T], out chan<- Merged[T]) {
+	defer close(out)
+	cases := make([]reflect.SelectCase, len(phs))
+	for i, ph := range phs {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(ph.Out),
+		}
+	}
+	next := 0
+	for remaining := len(phs); remaining > 0; {
+		i, res, ok := poll(phs, cases, next)
+		if !ok {
+			// no source is ready, wait for any of them
+			chosen, v, _ := reflect.Select(cases)
+			i, res = chosen, v.Interface().(Result[T])
+		}
+		next = (i + 1) % len(phs)
+		if !res.OK {
+			// Note: the case with zero Value will be ignored by reflect.Select
+			cases[i].Chan = reflect.Value{}
+			remaining--
+		}
+		out <- Merged[T]{
+			Result: res,
+			Source: i,
+		}
+	}
+}
+
+// poll tries to receive from the sources starting from next without blocking
+func poll[T any](phs []*Phos[T], cases []reflect.SelectCase, next int) (int, Result[T], bool) {
+	for j := 0; j < len(phs); j++ {
+		i := (next + j) % len(phs)
+		if !cases[i].Chan.IsValid() {
+			continue
+		}
+		select {
+		case res := <-phs[i].Out:
+			return i, res, true
+		default:
+		}
+	}
+	return 0, Result[T]{}, false
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestMerge(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	a, b := New[int](), New[int]()
+	a.Append(plusOne)
+	b.Append(plusThree)
+	merged := Merge(a, b)
+	a.In <- 10 // 10 + 1 = 11
+	b.In <- 10 // 10 + 3 = 13
+	got := map[int]int{}
+	for i := 0; i < 2; i++ {
+		res := <-merged
+		assert.True(t, res.OK)
+		assert.Nil(t, res.Err)
+		got[res.Source] = res.Data
+	}
+	assert.Equal(t, map[int]int{0: 11, 1: 13}, got)
+	a.Close()
+	res := <-merged
+	assert.Equal(t, 0, res.Source)
+	assert.False(t, res.OK)
+	b.In <- 20 // 20 + 3 = 23
+	res = <-merged
+	assert.Equal(t, 1, res.Source)
+	assert.Equal(t, 23, res.Data)
+	b.Close()
+	res = <-merged
+	assert.Equal(t, 1, res.Source)
+	assert.False(t, res.OK)
+	_, ok := <-merged
+	assert.False(t, ok)
+}
+
+func TestMergeFairness(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	a, b := New[int](), New[int]()
+	merged := Merge(a, b)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a.In <- i
+		}
+	}()
+	b.In <- 1000
+	// Note:
+	// The result of b must not wait for all the results of a
+	sources := make([]int, 0)
+	for {
+		res := <-merged
+		sources = append(sources, res.Source)
+		if res.Source == 1 {
+			break
+		}
+	}
+	assert.Less(t, len(sources), 10)
+	go func() {
+		for range merged {
+		}
+	}()
+	<-done
+	a.Close()
+	b.Close()
+}
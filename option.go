@@ -17,16 +17,43 @@ package phos
 
 import (
 	"context"
+	"maps"
+	"reflect"
 	"time"
 )
 
 var defaultOptions = Options{
-	Ctx:            context.Background(),
-	Zero:           false,
-	Timeout:        3 * time.Second,
-	ErrHandleFunc:  nil,
-	ErrTimeoutFunc: nil,
-	ErrDoneFunc:    nil,
+	Ctx:                context.Background(),
+	Zero:               false,
+	Timeout:            3 * time.Second,
+	ErrHandleFunc:      nil,
+	ErrTimeoutFunc:     nil,
+	ErrDoneFunc:        nil,
+	CloseOut:           false,
+	PauseInFlight:      false,
+	Rate:               0,
+	Burst:              0,
+	QueueSize:          1,
+	Overflow:           OverflowBlock,
+	ErrDropFunc:        nil,
+	Aging:              0,
+	KeyFunc:            nil,
+	Workers:            1,
+	StateStore:         nil,
+	WAL:                nil,
+	AckTimeout:         0,
+	MaxRedeliveries:    0,
+	ErrDeadLetterFunc:  nil,
+	CheckpointStore:    nil,
+	CheckpointInterval: 0,
+	Resume:             nil,
+	Recorder:           nil,
+	ItemDeadline:       false,
+	Late:               false,
+	LateBuffer:         0,
+	CloneFunc:          nil,
+	ErrCheckpointFunc:  nil,
+	Stages:             nil,
 }
 
 // Option for PHOS
@@ -34,33 +61,129 @@ type Option func(o *Options)
 
 // Options for PHOS
 type Options struct {
-	Ctx            context.Context
-	Zero           bool
-	Timeout        time.Duration
-	ErrHandleFunc  ErrHandleFunc
-	ErrTimeoutFunc ErrTimeoutFunc
-	ErrDoneFunc    ErrDoneFunc
+	Ctx                context.Context
+	Zero               bool
+	Timeout            time.Duration
+	ErrHandleFunc      ErrHandleFunc
+	ErrTimeoutFunc     ErrTimeoutFunc
+	ErrDoneFunc        ErrDoneFunc
+	CloseOut           bool
+	PauseInFlight      bool
+	Rate               float64
+	Burst              int
+	QueueSize          int
+	Overflow           OverflowPolicy
+	ErrDropFunc        ErrDropFunc
+	Aging              time.Duration
+	KeyFunc            KeyFunc
+	Workers            int
+	StateStore         StateStore
+	WAL                any
+	AckTimeout         time.Duration
+	MaxRedeliveries    int
+	ErrDeadLetterFunc  ErrDeadLetterFunc
+	CheckpointStore    CheckpointStore
+	CheckpointInterval time.Duration
+	Resume             *Checkpoint
+	Recorder           any
+	ItemDeadline       bool
+	Late               bool
+	LateBuffer         int
+	CloneFunc          CloneFunc
+	ErrCheckpointFunc  ErrCheckpointFunc
+	Stages             map[string]Stage
 }
 
 type (
-	ErrHandleFunc  func(ctx context.Context, data any, err error) any
-	ErrTimeoutFunc func(ctx context.Context, data any) any
-	ErrDoneFunc    func(ctx context.Context, data any, err error) any
+	ErrHandleFunc     func(ctx context.Context, data any, err error) any
+	ErrTimeoutFunc    func(ctx context.Context, data any) any
+	ErrDoneFunc       func(ctx context.Context, data any, err error) any
+	ErrDropFunc       func(ctx context.Context, data any)
+	KeyFunc           func(data any) string
+	ErrDeadLetterFunc func(ctx context.Context, data any)
+	CloneFunc         func(data any) any
+	ErrCheckpointFunc func(ctx context.Context, err error)
 )
 
 func newOptions(opts ...Option) *Options {
 	options := &Options{
-		Ctx:            defaultOptions.Ctx,
-		Zero:           defaultOptions.Zero,
-		Timeout:        defaultOptions.Timeout,
-		ErrHandleFunc:  defaultOptions.ErrHandleFunc,
-		ErrTimeoutFunc: defaultOptions.ErrTimeoutFunc,
-		ErrDoneFunc:    defaultOptions.ErrDoneFunc,
+		Ctx:                defaultOptions.Ctx,
+		Zero:               defaultOptions.Zero,
+		Timeout:            defaultOptions.Timeout,
+		ErrHandleFunc:      defaultOptions.ErrHandleFunc,
+		ErrTimeoutFunc:     defaultOptions.ErrTimeoutFunc,
+		ErrDoneFunc:        defaultOptions.ErrDoneFunc,
+		CloseOut:           defaultOptions.CloseOut,
+		PauseInFlight:      defaultOptions.PauseInFlight,
+		Rate:               defaultOptions.Rate,
+		Burst:              defaultOptions.Burst,
+		QueueSize:          defaultOptions.QueueSize,
+		Overflow:           defaultOptions.Overflow,
+		ErrDropFunc:        defaultOptions.ErrDropFunc,
+		Aging:              defaultOptions.Aging,
+		KeyFunc:            defaultOptions.KeyFunc,
+		Workers:            defaultOptions.Workers,
+		StateStore:         defaultOptions.StateStore,
+		WAL:                defaultOptions.WAL,
+		AckTimeout:         defaultOptions.AckTimeout,
+		MaxRedeliveries:    defaultOptions.MaxRedeliveries,
+		ErrDeadLetterFunc:  defaultOptions.ErrDeadLetterFunc,
+		CheckpointStore:    defaultOptions.CheckpointStore,
+		CheckpointInterval: defaultOptions.CheckpointInterval,
+		Resume:             defaultOptions.Resume,
+		Recorder:           defaultOptions.Recorder,
+		ItemDeadline:       defaultOptions.ItemDeadline,
+		Late:               defaultOptions.Late,
+		LateBuffer:         defaultOptions.LateBuffer,
+		CloneFunc:          defaultOptions.CloneFunc,
+		ErrCheckpointFunc:  defaultOptions.ErrCheckpointFunc,
+		Stages:             defaultOptions.Stages,
 	}
 	options.apply(opts...)
 	return options
 }
 
+// mutableOptions are the options which can be changed by Update
+var mutableOptions = map[string]bool{
+	"Zero":              true,
+	"Timeout":           true,
+	"ErrHandleFunc":     true,
+	"ErrTimeoutFunc":    true,
+	"ErrDoneFunc":       true,
+	"PauseInFlight":     true,
+	"ErrDropFunc":       true,
+	"MaxRedeliveries":   true,
+	"ItemDeadline":      true,
+	"CloneFunc":         true,
+	"ErrDeadLetterFunc": true,
+	"ErrCheckpointFunc": true,
+}
+
+// changedImmutable returns the name of the first option which is changed from cur to next but not in mutableOptions,
+// set is the options applied to the zero Options which tells the funcs set by the update
+func changedImmutable(cur, next, set *Options) (string, bool) {
+	cv, nv, sv := reflect.ValueOf(cur).Elem(), reflect.ValueOf(next).Elem(), reflect.ValueOf(set).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		name := cv.Type().Field(i).Name
+		if mutableOptions[name] {
+			continue
+		}
+		a, b := cv.Field(i), nv.Field(i)
+		if a.Kind() == reflect.Func {
+			// Note: funcs are not comparable (the closures of the same literal share the code pointer),
+			// so setting an immutable func is regarded as a change even if it is the same func
+			if !sv.Field(i).IsNil() {
+				return name, true
+			}
+			continue
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 func (o *Options) apply(opts ...Option) {
 	for _, opt := range opts {
 		opt(o)
@@ -82,12 +205,31 @@ func WithZero() Option {
 }
 
 // WithTimeout will set timeout for the handler chain execution (not just for each handler)
+// There is no timeout if timeout <= 0, see WithNoTimeout
 func WithTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
 		o.Timeout = timeout
 	}
 }
 
+// WithNoTimeout will make the handler chain execution wait until it is done or the context of PHOS is done,
+// no timer will be created for the data
+func WithNoTimeout() Option {
+	return func(o *Options) {
+		o.Timeout = 0
+	}
+}
+
+// WithItemDeadline will take the deadline of the handler chain execution from the context passed to SendContext
+// or SendPriority instead of the timeout, the timeout is still used for the data without deadline
+// The TimeoutErr Error wraps ErrDeadline if the deadline of the data is exceeded, or ErrTimeout otherwise
+// Note: Only the deadline is taken, the cancellation of the context will not cancel the handler chain
+func WithItemDeadline() Option {
+	return func(o *Options) {
+		o.ItemDeadline = true
+	}
+}
+
 // WithErrHandleFunc will set error handle function for PHOS which will be called when handle error happened
 func WithErrHandleFunc(fn ErrHandleFunc) Option {
 	return func(o *Options) {
@@ -109,3 +251,188 @@ func WithErrDoneFunc(fn ErrDoneFunc) Option {
 		o.ErrDoneFunc = fn
 	}
 }
+
+// WithCloseOut will make PHOS close the Out channel after the last result is delivered,
+// instead of sending a Result with OK == false, so that Out can be ranged over
+func WithCloseOut() Option {
+	return func(o *Options) {
+		o.CloseOut = true
+	}
+}
+
+// WithPauseInFlight will make the handler chains in handling wait at handler boundaries when PHOS is paused
+// Note: The timeout of the handler chain will not be stopped while waiting
+func WithPauseInFlight() Option {
+	return func(o *Options) {
+		o.PauseInFlight = true
+	}
+}
+
+// WithRateLimit will limit the handler chain executions of PHOS to rate per second with burst
+// The waiting counts against the timeout of the handler chain, a RateLimitErr will be returned without waiting
+// if the token will not be available before the timeout, use RateLimitHandler to limit a single handler
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *Options) {
+		o.Rate = rate
+		o.Burst = burst
+	}
+}
+
+// WithQueueSize will set the size of the queue which buffers the data before handling
+func WithQueueSize(size int) Option {
+	return func(o *Options) {
+		o.QueueSize = size
+	}
+}
+
+// WithOverflow will set the policy which will be used when the queue is full
+func WithOverflow(policy OverflowPolicy) Option {
+	return func(o *Options) {
+		o.Overflow = policy
+	}
+}
+
+// WithErrDropFunc will set err drop function for PHOS which will be called when data is dropped by the overflow policy
+// Note: The dropped data will be reported to Out with DroppedErr if the function is not set,
+// both are done by PHOS asynchronously so that the sender will not be blocked
+func WithErrDropFunc(fn ErrDropFunc) Option {
+	return func(o *Options) {
+		o.ErrDropFunc = fn
+	}
+}
+
+// WithAging will raise the priority of the queued data by one for every aging duration it has waited,
+// so that the data with low priority will not be starved by the data with high priority
+func WithAging(aging time.Duration) Option {
+	return func(o *Options) {
+		o.Aging = aging
+	}
+}
+
+// WithKeyFunc will enable keyed partitioning, the data with the same key will be handled sequentially in order,
+// and the data with different keys will be handled in parallel by the workers set by WithWorkers
+// Note: The worker waits for the handler chain timed out to return before the next data,
+// so the handlers should respect the cancellation of ctx
+func WithKeyFunc(fn KeyFunc) Option {
+	return func(o *Options) {
+		o.KeyFunc = fn
+	}
+}
+
+// WithWorkers will set the number of workers for keyed partitioning
+// Note: You should use it with WithKeyFunc, otherwise it will not work
+func WithWorkers(n int) Option {
+	return func(o *Options) {
+		o.Workers = n
+	}
+}
+
+// WithStateStore will set the store of the per-key State which can be accessed by StateFrom in handlers
+// Note: You should use it with WithKeyFunc, a MemoryStore will be used if it is not set
+func WithStateStore(store StateStore) Option {
+	return func(o *Options) {
+		o.StateStore = store
+	}
+}
+
+// WithWAL will persist the data accepted by PHOS to the WAL and replay the unfinished data of the WAL when PHOS is created
+// The WAL implies Ack, the data is marked done only when its result is consumed and acknowledged by Ack (or Nack to
+// the dead letter), the results are not redelivered unless the visibility timeout is set by WithAck
+// Note: The WAL will be closed by PHOS, and it must not be shared by multiple PHOS
+func WithWAL[T any](wal *WAL[T]) Option {
+	return func(o *Options) {
+		o.WAL = wal
+	}
+}
+
+// WithAck will make the results wait for Ack, the result which is not acknowledged within the visibility timeout
+// will be redelivered to Out with Redeliveries increased
+// Note: The data will be marked done in the WAL when its result is acknowledged, Ack is always required with WithWAL
+func WithAck(visibility time.Duration) Option {
+	return func(o *Options) {
+		o.AckTimeout = visibility
+	}
+}
+
+// WithMaxRedeliveries will set the max number of redeliveries of a result (no limit if <= 0),
+// the result will be sent to the dead letter if it is exceeded
+func WithMaxRedeliveries(n int) Option {
+	return func(o *Options) {
+		o.MaxRedeliveries = n
+	}
+}
+
+// WithErrDeadLetterFunc will set err dead letter function which will be called when a result is rejected by Nack
+// or exceeds the max redeliveries, a result with DeadLetterErr will be delivered to Out if it is not set
+func WithErrDeadLetterFunc(fn ErrDeadLetterFunc) Option {
+	return func(o *Options) {
+		o.ErrDeadLetterFunc = fn
+	}
+}
+
+// WithCheckpoint will save a checkpoint to store every interval (only by Checkpoint and Close if interval <= 0)
+// The checkpoint is taken between the data handling, so it waits for the in-flight data
+func WithCheckpoint(store CheckpointStore, interval time.Duration) Option {
+	return func(o *Options) {
+		o.CheckpointStore = store
+		o.CheckpointInterval = interval
+	}
+}
+
+// WithErrCheckpointFunc will set err checkpoint function for PHOS which will be called when the checkpoint
+// taken periodically or by Close fails to be saved (the error of the checkpoint taken by Checkpoint is returned),
+// or the state of a stage set by WithStage fails to be restored by WithResume (the stage starts from empty)
+func WithErrCheckpointFunc(fn ErrCheckpointFunc) Option {
+	return func(o *Options) {
+		o.ErrCheckpointFunc = fn
+	}
+}
+
+// WithStage will save the state of stage (e.g. Window and Dedup) in the checkpoint by name and restore it on resume
+// Note: The data consumed by the stages (ErrSkip) is regarded as processed, so their state must be saved together
+func WithStage(name string, stage Stage) Option {
+	return func(o *Options) {
+		// Note: copy on write, the map may be shared by the options replaced by Update
+		stages := maps.Clone(o.Stages)
+		if stages == nil {
+			stages = make(map[string]Stage)
+		}
+		stages[name] = stage
+		o.Stages = stages
+	}
+}
+
+// WithResume will resume PHOS from the checkpoint (e.g. loaded from CheckpointStore), nothing will be done if cp is nil
+// The sequence numbers continue from the checkpoint, the state is restored if the StateStore implements Snapshotter,
+// the state of the stages set by WithStage is restored, and the data of the WAL before the checkpoint will not be replayed
+// Note: The producer should skip the first Seq data of the source
+func WithResume(cp *Checkpoint) Option {
+	return func(o *Options) {
+		o.Resume = cp
+	}
+}
+
+// WithRecorder will record the data accepted by PHOS with their time, priority and metadata, see Replay
+func WithRecorder[T any](recorder *Recorder[T]) Option {
+	return func(o *Options) {
+		o.Recorder = recorder
+	}
+}
+
+// WithLate will deliver the real results of the handler chains finished after the timeout to Late with buffer
+// Note: The late result is correlated with the timeout result by Seq, which is only assigned to the data sent via In, TrySend, SendContext or SendPriority
+func WithLate(buffer int) Option {
+	return func(o *Options) {
+		o.Late = true
+		o.LateBuffer = buffer
+	}
+}
+
+// WithCloneFunc will set clone function which returns a copy of data, the handler chain will be executed with the copy
+// so that the data passed to ErrTimeoutFunc and ErrDoneFunc is never mutated by the timed out chain
+// Note: The Clone method is used if the data implements Cloner and the clone function is not set
+func WithCloneFunc(fn CloneFunc) Option {
+	return func(o *Options) {
+		o.CloneFunc = fn
+	}
+}
@@ -17,11 +17,18 @@ package phos
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 )
 
 func TestOptions(t *testing.T) {
@@ -34,6 +41,16 @@ func TestOptions(t *testing.T) {
 	errDoneFunc := func(ctx context.Context, data any, err error) any {
 		return nil
 	}
+	errDropFunc := func(ctx context.Context, data any) {}
+	keyFunc := func(data any) string {
+		return ""
+	}
+	errDeadLetterFunc := func(ctx context.Context, data any) {}
+	cloneFunc := func(data any) any {
+		return data
+	}
+	errCheckpointFunc := func(ctx context.Context, err error) {}
+	dedup := NewDedup[int](strconv.Itoa)
 	options := newOptions(
 		WithContext(context.TODO()),
 		WithZero(),
@@ -41,6 +58,28 @@ func TestOptions(t *testing.T) {
 		WithErrHandleFunc(errHandleFunc),
 		WithErrTimeoutFunc(errTimeoutFunc),
 		WithErrDoneFunc(errDoneFunc),
+		WithCloseOut(),
+		WithPauseInFlight(),
+		WithRateLimit(10, 5),
+		WithQueueSize(8),
+		WithOverflow(OverflowDropOldest),
+		WithErrDropFunc(errDropFunc),
+		WithAging(time.Second),
+		WithKeyFunc(keyFunc),
+		WithWorkers(4),
+		WithStateStore(NewMemoryStore()),
+		WithWAL(&WAL[int]{}),
+		WithAck(time.Second),
+		WithMaxRedeliveries(3),
+		WithErrDeadLetterFunc(errDeadLetterFunc),
+		WithCheckpoint(NewFileCheckpointStore("checkpoint.json"), time.Minute),
+		WithResume(&Checkpoint{Seq: 1}),
+		WithRecorder(NewRecorder[int](io.Discard, JSONCodec[int]{})),
+		WithItemDeadline(),
+		WithLate(4),
+		WithCloneFunc(cloneFunc),
+		WithErrCheckpointFunc(errCheckpointFunc),
+		WithStage("dedup", dedup),
 	)
 	assert.Equal(t, context.TODO(), options.Ctx)
 	assert.True(t, options.Zero)
@@ -48,6 +87,31 @@ func TestOptions(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("%p", errHandleFunc), fmt.Sprintf("%p", options.ErrHandleFunc))
 	assert.Equal(t, fmt.Sprintf("%p", errTimeoutFunc), fmt.Sprintf("%p", options.ErrTimeoutFunc))
 	assert.Equal(t, fmt.Sprintf("%p", errDoneFunc), fmt.Sprintf("%p", options.ErrDoneFunc))
+	assert.True(t, options.CloseOut)
+	assert.True(t, options.PauseInFlight)
+	assert.Equal(t, float64(10), options.Rate)
+	assert.Equal(t, 5, options.Burst)
+	assert.Equal(t, 8, options.QueueSize)
+	assert.Equal(t, OverflowDropOldest, options.Overflow)
+	assert.Equal(t, fmt.Sprintf("%p", errDropFunc), fmt.Sprintf("%p", options.ErrDropFunc))
+	assert.Equal(t, time.Second, options.Aging)
+	assert.Equal(t, fmt.Sprintf("%p", keyFunc), fmt.Sprintf("%p", options.KeyFunc))
+	assert.Equal(t, 4, options.Workers)
+	assert.NotNil(t, options.StateStore)
+	assert.IsType(t, &WAL[int]{}, options.WAL)
+	assert.Equal(t, time.Second, options.AckTimeout)
+	assert.Equal(t, 3, options.MaxRedeliveries)
+	assert.Equal(t, fmt.Sprintf("%p", errDeadLetterFunc), fmt.Sprintf("%p", options.ErrDeadLetterFunc))
+	assert.NotNil(t, options.CheckpointStore)
+	assert.Equal(t, time.Minute, options.CheckpointInterval)
+	assert.Equal(t, uint64(1), options.Resume.Seq)
+	assert.IsType(t, &Recorder[int]{}, options.Recorder)
+	assert.True(t, options.ItemDeadline)
+	assert.True(t, options.Late)
+	assert.Equal(t, 4, options.LateBuffer)
+	assert.Equal(t, fmt.Sprintf("%p", cloneFunc), fmt.Sprintf("%p", options.CloneFunc))
+	assert.Equal(t, fmt.Sprintf("%p", errCheckpointFunc), fmt.Sprintf("%p", options.ErrCheckpointFunc))
+	assert.Equal(t, map[string]Stage{"dedup": dedup}, options.Stages)
 }
 
 func TestDefaultOptions(t *testing.T) {
@@ -58,4 +122,102 @@ func TestDefaultOptions(t *testing.T) {
 	assert.Nil(t, options.ErrHandleFunc)
 	assert.Nil(t, options.ErrTimeoutFunc)
 	assert.Nil(t, options.ErrDoneFunc)
+	assert.False(t, options.CloseOut)
+	assert.False(t, options.PauseInFlight)
+	assert.Zero(t, options.Rate)
+	assert.Zero(t, options.Burst)
+	assert.Equal(t, 1, options.QueueSize)
+	assert.Equal(t, OverflowBlock, options.Overflow)
+	assert.Nil(t, options.ErrDropFunc)
+	assert.Zero(t, options.Aging)
+	assert.Nil(t, options.KeyFunc)
+	assert.Equal(t, 1, options.Workers)
+	assert.Nil(t, options.StateStore)
+	assert.Nil(t, options.WAL)
+	assert.Zero(t, options.AckTimeout)
+	assert.Zero(t, options.MaxRedeliveries)
+	assert.Nil(t, options.ErrDeadLetterFunc)
+	assert.Nil(t, options.CheckpointStore)
+	assert.Zero(t, options.CheckpointInterval)
+	assert.Nil(t, options.Resume)
+	assert.Nil(t, options.Recorder)
+	assert.False(t, options.ItemDeadline)
+	assert.False(t, options.Late)
+	assert.Zero(t, options.LateBuffer)
+	assert.Nil(t, options.CloneFunc)
+	assert.Nil(t, options.ErrCheckpointFunc)
+	assert.Nil(t, options.Stages)
+}
+
+func TestUpdate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	defer ph.Close()
+	ph.Append(plusOneWithCtxSleep)
+	assert.Nil(t, ph.Update(WithTimeout(10*time.Millisecond), WithErrTimeoutFunc(func(ctx context.Context, data any) any {
+		return data.(int) * 10
+	})))
+	assert.Equal(t, 10*time.Millisecond, ph.Options().Timeout)
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Equal(t, TimeoutErr, res.Err.Type)
+	assert.Equal(t, 10, res.Data)
+	// Note:
+	// The options which can only be set by New are not updated
+	assert.ErrorIs(t, ph.Update(WithTimeout(time.Second), WithQueueSize(8)), ErrImmutableOption)
+	assert.Equal(t, 10*time.Millisecond, ph.Options().Timeout)
+	assert.Equal(t, 1, ph.Options().QueueSize)
+}
+
+func TestUpdateInFlight(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	defer ph.Close()
+	started, release := make(chan struct{}), make(chan struct{})
+	ph.Append(func(_ context.Context, data int) (int, error) {
+		close(started)
+		<-release
+		return data + 1, errors.New("handler error")
+	})
+	ph.In <- 1
+	<-started
+	assert.Nil(t, ph.Update(WithZero()))
+	close(release)
+	// Note:
+	// The data in handling uses the options when it starts, so Zero takes effect for the next data
+	res := <-ph.Out
+	assert.Equal(t, HandlerErr, res.Err.Type)
+	assert.Equal(t, 2, res.Data)
+}
+
+func TestUpdateImmutableFunc(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	keyFunc := func(prefix string) KeyFunc {
+		return func(data any) string {
+			return prefix + fmt.Sprint(data)
+		}
+	}
+	ph := New[int](WithKeyFunc(keyFunc("a")))
+	defer ph.Close()
+	// Note:
+	// The closures of the same func literal share the code pointer, but they are different funcs
+	assert.ErrorIs(t, ph.Update(WithKeyFunc(keyFunc("b"))), ErrImmutableOption)
+	assert.Equal(t, "a1", ph.Options().KeyFunc(1))
+	assert.Nil(t, ph.Update(WithErrDropFunc(func(context.Context, any) {})))
+}
+
+func TestUpdateDoc(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "phos.go", nil, parser.ParseComments)
+	assert.Nil(t, err)
+	var doc string
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "Update" {
+			doc = fn.Doc.Text()
+		}
+	}
+	// Note:
+	// The doc of Update must list every mutable option
+	for name := range mutableOptions {
+		assert.Contains(t, doc, name)
+	}
 }
@@ -0,0 +1,65 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import "hash/fnv"
+
+// partitions run the items with the same key sequentially on the same worker,
+// and the items with different keys in parallel on different workers
+type partitions[T any] struct {
+	workers []chan *item[T]
+}
+
+func newPartitions[T any](ph *Phos[T], n int) *partitions[T] {
+	if n < 1 {
+		n = 1
+	}
+	p := &partitions[T]{
+		workers: make([]chan *item[T], n),
+	}
+	for i := range p.workers {
+		c := make(chan *item[T], 1)
+		p.workers[i] = c
+		ph.workerWg.Add(1)
+		go func() {
+			defer ph.workerWg.Done()
+			for it := range c {
+				ph.execute(it)
+				// Note: the chain timed out is still running, wait for it so that the items of the same key never overlap
+				if it.chainC != nil {
+					<-it.chainC
+				}
+				ph.pending.Done()
+			}
+		}()
+	}
+	return p
+}
+
+// dispatch sends the item to the worker of its key
+// Note: dispatch blocks if the worker is busy, the items of other keys will wait as well
+func (p *partitions[T]) dispatch(it *item[T]) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(it.key))
+	p.workers[h.Sum32()%uint32(len(p.workers))] <- it
+}
+
+// close the workers after all the dispatched items are handled
+func (p *partitions[T]) close() {
+	for _, c := range p.workers {
+		close(c)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func parity(data any) string {
+	return strconv.Itoa(data.(int) % 2)
+}
+
+func TestKeyedPartitioning(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithKeyFunc(parity), WithWorkers(2), WithQueueSize(6))
+	ph.Append(func(_ context.Context, data int) (int, error) {
+		// Note:
+		// The odd data is slow, but it should not block the even data
+		if data%2 == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return data + 1, nil
+	})
+	for i := 1; i <= 6; i++ {
+		ph.In <- i
+	}
+	var odd, even, all []int
+	for i := 0; i < 6; i++ {
+		res := <-ph.Out
+		assert.True(t, res.OK)
+		assert.Nil(t, res.Err)
+		all = append(all, res.Data)
+		if res.Data%2 == 0 {
+			odd = append(odd, res.Data)
+		} else {
+			even = append(even, res.Data)
+		}
+	}
+	// Note:
+	// The data with the same key is handled in order
+	assert.Equal(t, []int{2, 4, 6}, odd)
+	assert.Equal(t, []int{3, 5, 7}, even)
+	assert.Equal(t, 6, all[len(all)-1])
+	go ph.Close()
+	assert.False(t, (<-ph.Out).OK)
+}
+
+func TestKeyedPartitioningTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	var (
+		mu    sync.Mutex
+		steps []int
+	)
+	ph := New[int](WithKeyFunc(func(any) string { return "" }), WithTimeout(50*time.Millisecond), WithQueueSize(2))
+	ph.Append(func(_ context.Context, data int) (int, error) {
+		mu.Lock()
+		steps = append(steps, data)
+		mu.Unlock()
+		time.Sleep(200 * time.Millisecond)
+		mu.Lock()
+		steps = append(steps, -data)
+		mu.Unlock()
+		return data, nil
+	})
+	ph.In <- 1
+	ph.In <- 2
+	// Note:
+	// The timed out chain keeps running, the next data of the same key waits for it
+	assert.Equal(t, TimeoutErr, (<-ph.Out).Err.Type)
+	assert.Equal(t, TimeoutErr, (<-ph.Out).Err.Type)
+	go ph.Close()
+	<-ph.Out
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{1, -1, 2, -2}, steps)
+}
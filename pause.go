@@ -0,0 +1,107 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type pauser struct {
+	mu      sync.Mutex
+	paused  bool
+	resumeC chan struct{}
+	since   time.Time
+	total   time.Duration
+	count   uint64
+}
+
+// Pause stops PHOS from receiving data from In, the data in handling will not be affected
+// unless WithPauseInFlight is enabled
+// Note: Pause does nothing after Close
+func (ph *Phos[T]) Pause() {
+	ph.pauser.mu.Lock()
+	defer ph.pauser.mu.Unlock()
+	if ph.pauser.paused {
+		return
+	}
+	select {
+	case <-ph.stopC:
+		return
+	default:
+	}
+	ph.pauser.paused = true
+	ph.pauser.resumeC = make(chan struct{})
+	ph.pauser.since = time.Now()
+	ph.pauser.count++
+	ph.wake()
+}
+
+// Resume PHOS after Pause
+func (ph *Phos[T]) Resume() {
+	ph.pauser.mu.Lock()
+	defer ph.pauser.mu.Unlock()
+	if !ph.pauser.paused {
+		return
+	}
+	ph.pauser.paused = false
+	ph.pauser.total += time.Since(ph.pauser.since)
+	close(ph.pauser.resumeC)
+	ph.wake()
+}
+
+// Paused reports whether PHOS is paused
+func (ph *Phos[T]) Paused() bool {
+	ph.pauser.mu.Lock()
+	defer ph.pauser.mu.Unlock()
+	return ph.pauser.paused
+}
+
+// wake the handle loop to check the pause state again
+func (ph *Phos[T]) wake() {
+	select {
+	case ph.wakeC <- struct{}{}:
+	default:
+	}
+}
+
+// waitResume blocks until PHOS is resumed, it returns false if ctx is done before that
+func (ph *Phos[T]) waitResume(ctx context.Context) bool {
+	ph.pauser.mu.Lock()
+	paused, resumeC := ph.pauser.paused, ph.pauser.resumeC
+	ph.pauser.mu.Unlock()
+	if !paused {
+		return true
+	}
+	select {
+	case <-resumeC:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// stats returns the pause state, the total time spent paused and the number of pauses
+func (p *pauser) stats() (bool, time.Duration, uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := p.total
+	if p.paused {
+		total += time.Since(p.since)
+	}
+	return p.paused, total, p.count
+}
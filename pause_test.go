@@ -0,0 +1,85 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestPauseAndResume(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	defer ph.Close()
+	ph.Append(plusOne)
+	ph.Pause()
+	assert.True(t, ph.Paused())
+	ph.In <- 10
+	select {
+	case <-ph.Out:
+		t.Fatal("PHOS should not handle data when paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+	ph.Resume()
+	assert.False(t, ph.Paused())
+	res := <-ph.Out
+	assert.Equal(t, 11, res.Data)
+	stats := ph.Stats()
+	assert.False(t, stats.Paused)
+	assert.Equal(t, uint64(1), stats.Pauses)
+	assert.GreaterOrEqual(t, stats.PausedTime, 100*time.Millisecond)
+}
+
+func TestPauseInFlight(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithPauseInFlight())
+	defer ph.Close()
+	entered := make(chan struct{})
+	ph.Append(func(_ context.Context, data int) (int, error) {
+		close(entered)
+		time.Sleep(50 * time.Millisecond)
+		return data + 1, nil
+	}, plusThree)
+	ph.In <- 10
+	<-entered
+	ph.Pause()
+	select {
+	case <-ph.Out:
+		t.Fatal("the handler chain should wait at the handler boundary when paused")
+	case <-time.After(200 * time.Millisecond):
+	}
+	ph.Resume()
+	res := <-ph.Out
+	assert.Equal(t, 14, res.Data)
+	assert.Nil(t, res.Err)
+}
+
+func TestCloseWhenPaused(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	ph.Pause()
+	ph.In <- 10
+	go ph.Close()
+	// Note:
+	// Close will resume PHOS to drain the buffered data
+	assert.Equal(t, 11, (<-ph.Out).Data)
+	assert.False(t, (<-ph.Out).OK)
+}
@@ -17,8 +17,11 @@ package phos
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,17 +32,65 @@ type Phos[T any] struct {
 	Out <-chan Result[T]
 
 	handlers []Handler[T]
+	// previous is the handler chain replaced by Swap, nil if there is nothing to roll back
+	previous []Handler[T]
+	// version of the handler chain, it is increased when the indexes of the chain are changed by Swap, Rollback or Delete
+	version uint64
 
-	options *Options
+	// options is replaced by Update, it must be read by opts
+	options atomic.Pointer[Options]
 
-	once sync.Once
-	mu   sync.RWMutex
-	wg   sync.WaitGroup
+	// ctx is derived from the context of options, it will be canceled when Shutdown is forced to abort
+	ctx    context.Context
+	cancel context.CancelFunc
 
-	appendC  chan Handler[T]
-	deleteC  chan int
-	receiveC chan Result[T]
-	closeC   chan struct{}
+	once     sync.Once
+	mu       sync.RWMutex
+	wg       sync.WaitGroup
+	workerWg sync.WaitGroup
+	pending  sync.WaitGroup
+	subMu    sync.Mutex
+	optMu    sync.Mutex
+	sendMu   sync.RWMutex
+
+	in         chan T
+	out        chan Result[T]
+	queue      *queue[T]
+	partitions *partitions[T]
+	wal        *WAL[T]
+	acker      *acker[T]
+	recorder   *Recorder[T]
+	// late is nil unless WithLate is enabled
+	late chan Result[T]
+	// checkpointer is nil unless WithCheckpoint is enabled
+	checkpointer *checkpointer
+
+	subs map[<-chan Result[T]]*subscriber[T]
+
+	pauser   pauser
+	limiter  *limiter
+	flushers []func() bool
+	wakeC    chan struct{}
+	// drops is the dropped items waiting to be reported by the handle loop
+	drops  []*item[T]
+	dropMu sync.Mutex
+
+	aborted   atomic.Bool
+	abandoned atomic.Int64
+	dropped   atomic.Uint64
+	// seq is the sequence number of the last accepted data
+	seq atomic.Uint64
+
+	stopC  chan struct{}
+	closeC chan struct{}
+	// abortC is closed when Shutdown is aborted, the results will not be waited to be received from Out afterwards
+	abortC chan struct{}
+}
+
+// Cloner is implemented by the data which can be copied, the handler chain will be executed with a copy of the data
+// so that the data passed to the timeout callback is not shared with the timed out chain, see WithCloneFunc
+type Cloner[T any] interface {
+	Clone() T
 }
 
 // Handler handles the data of PHOS channel
@@ -48,9 +99,21 @@ type Handler[T any] func(ctx context.Context, input T) (output T, err error)
 // Result PHOS output result
 type Result[T any] struct {
 	Data T
-	// Note: You should use the OK of Result rather than the second return value of PHOS Out channel
+	// Note: You should use the OK of Result rather than the second return value of PHOS Out channel,
+	// unless WithCloseOut is enabled
 	OK  bool
 	Err *Error
+	// Redeliveries is the number of times the result has been redelivered, see WithAck
+	Redeliveries int
+	// Seq is the sequence number of the data, it correlates the late result with the timeout result, see WithLate
+	// Note: Seq is only assigned to the data sent via In, TrySend, SendContext or SendPriority, it is 0 for the aggregates injected by Window
+	Seq uint64
+
+	// skip is true if a handler returned ErrSkip, the result will not be delivered
+	skip bool
+	// acker and id identify the delivery to be acknowledged
+	acker *acker[T]
+	id    uint64
 }
 
 // New PHOS channel
@@ -61,30 +124,124 @@ func New[T any](opts ...Option) *Phos[T] {
 	options := newOptions(opts...)
 	in := make(chan T, 1)
 	out := make(chan Result[T], 1)
+	ctx, cancel := context.WithCancel(options.Ctx)
 	ph := &Phos[T]{
-		options:  options,
+		ctx:      ctx,
+		cancel:   cancel,
 		In:       in,
 		Out:      out,
+		in:       in,
+		out:      out,
+		queue:    newQueue[T](options.QueueSize, options.Overflow, options.Aging),
 		handlers: make([]Handler[T], 0),
-		appendC:  make(chan Handler[T]),
-		deleteC:  make(chan int),
-		receiveC: make(chan Result[T]),
+		subs:     make(map[<-chan Result[T]]*subscriber[T]),
+		wakeC:    make(chan struct{}, 1),
+		stopC:    make(chan struct{}),
 		closeC:   make(chan struct{}),
+		abortC:   make(chan struct{}),
+	}
+	ph.options.Store(options)
+	if options.Rate > 0 {
+		ph.limiter = newLimiter(options.Rate, options.Burst)
+	}
+	if options.KeyFunc != nil {
+		if options.StateStore == nil {
+			options.StateStore = NewMemoryStore()
+		}
+		ph.partitions = newPartitions(ph, options.Workers)
+	}
+	// Note: the WAL implies Ack so that the data is marked done only after its result is consumed
+	if options.AckTimeout > 0 || options.WAL != nil {
+		ph.acker = newAcker(ph)
+	}
+	if options.Late {
+		ph.late = make(chan Result[T], options.LateBuffer)
+	}
+	if options.WAL != nil {
+		wal, ok := options.WAL.(*WAL[T])
+		if !ok {
+			panic(fmt.Sprintf("phos: WithWAL expects *WAL[%T], got %T", *new(T), options.WAL))
+		}
+		ph.wal = wal
+	}
+	if options.Recorder != nil {
+		recorder, ok := options.Recorder.(*Recorder[T])
+		if !ok {
+			panic(fmt.Sprintf("phos: WithRecorder expects *Recorder[%T], got %T", *new(T), options.Recorder))
+		}
+		ph.recorder = recorder
+	}
+	if options.CheckpointStore != nil {
+		ph.checkpointer = newCheckpointer(options.CheckpointStore, options.CheckpointInterval, options.Resume)
+	}
+	if options.Resume != nil {
+		ph.resume(options.Resume)
 	}
-	go ph.handle(in, out)
+	for _, stage := range options.Stages {
+		// Note: the restored windows need PHOS to be fired before any data is handled
+		if b, ok := stage.(interface{ bind(ph *Phos[T]) }); ok {
+			b.bind(ph)
+		}
+	}
+	if ph.wal != nil {
+		// Note: the unfinished data of the WAL will be handled before the data sent to In
+		for _, e := range ph.wal.entries() {
+			it := &item[T]{
+				data: e.data,
+				seq:  e.seq,
+			}
+			// Note: the data before the checkpoint has been processed
+			if options.Resume != nil && e.seq <= options.Resume.Seq {
+				ph.finish(it)
+				continue
+			}
+			if ph.checkpointer != nil {
+				ph.checkpointer.start(it.seq)
+			}
+			ph.queue.inject(it)
+		}
+	}
+	go ph.pump(in)
+	go ph.handle()
 	return ph
 }
 
 // Close PHOS channel
-// Note: You should not close In channel manually before or after calling Close
+// Close will wait for the buffered and in-flight data to be handled, use Shutdown if you need a deadline
+// Note: You should not close In channel manually before or after calling Close,
+// and sending to In after Close will panic, use TrySend or SendContext if the producers may race with Close
 func (ph *Phos[T]) Close() {
+	_ = ph.Shutdown(context.Background())
+}
+
+// Shutdown closes PHOS gracefully
+// Shutdown stops accepting new data and waits for the buffered and in-flight data to be handled and delivered to Out.
+// If ctx is done before that, the in-flight chain will be canceled (a result with CtxErr will be delivered)
+// and the buffered data will be dropped, a ShutdownError reporting the number of abandoned data will be returned
+// After ctx is done, the results are only delivered if Out is being read, the unread ones are dropped
+// and counted as abandoned (they will be replayed if the WAL is enabled)
+// Note: The in-flight handlers should respect the cancellation of ctx, Shutdown waits for them to return
+func (ph *Phos[T]) Shutdown(ctx context.Context) error {
+	var err error
 	ph.once.Do(func() {
-		close(ph.In)
-		close(ph.appendC)
-		close(ph.deleteC)
+		defer ph.cancel()
+		// Note: PHOS must be resumed to drain the buffered data
+		ph.Resume()
+		ph.stop()
+		select {
+		case <-ph.closeC:
+			return
+		case <-ctx.Done():
+		}
+		ph.aborted.Store(true)
+		close(ph.abortC)
+		ph.cancel()
 		<-ph.closeC
-		close(ph.receiveC)
+		if abandoned := int(ph.abandoned.Load()); abandoned > 0 {
+			err = shutdownError(ctx.Err(), abandoned)
+		}
 	})
+	return err
 }
 
 // Len return the number of handlers
@@ -94,16 +251,113 @@ func (ph *Phos[T]) Len() int {
 	return len(ph.handlers)
 }
 
+// StateStore returns the store of the per-key State,
+// it is the one set by WithStateStore or a MemoryStore created when keyed partitioning is enabled
+func (ph *Phos[T]) StateStore() StateStore {
+	return ph.opts().StateStore
+}
+
+// Late returns the channel which receives the real results of the handler chains finished after the timeout
+// (or the context of PHOS done), the Seq of the late result is the same as the timeout result delivered to Out
+// The channel will be closed after Close when all the handler chains have returned, it is nil unless WithLate is enabled
+// Note: The late result will be dropped if the buffer of the channel is full,
+// the late results of the aggregates injected by Window and the executions via AsHandler have Seq 0 and cannot be correlated
+func (ph *Phos[T]) Late() <-chan Result[T] {
+	return ph.late
+}
+
+func (ph *Phos[T]) reportLate(res Result[T]) {
+	if ph.late == nil {
+		return
+	}
+	select {
+	case ph.late <- res:
+	default:
+	}
+}
+
+// Options returns a snapshot of the options of PHOS
+func (ph *Phos[T]) Options() Options {
+	return *ph.opts()
+}
+
+// Update applies opts to the options of PHOS, the new options will take effect for the next data
+// Only Zero, Timeout, PauseInFlight, ItemDeadline, CloneFunc, MaxRedeliveries and the error funcs (ErrHandleFunc,
+// ErrTimeoutFunc, ErrDoneFunc, ErrDropFunc, ErrDeadLetterFunc, ErrCheckpointFunc) can be updated, ErrImmutableOption will be returned
+// and nothing will be updated if opts change other options
+// Note: Funcs are not comparable, so the options setting other funcs (e.g. WithKeyFunc) are always rejected
+func (ph *Phos[T]) Update(opts ...Option) error {
+	ph.optMu.Lock()
+	defer ph.optMu.Unlock()
+	cur := ph.opts()
+	next := *cur
+	next.apply(opts...)
+	var set Options
+	set.apply(opts...)
+	if name, ok := changedImmutable(cur, &next, &set); ok {
+		return fmt.Errorf("%w: %s", ErrImmutableOption, name)
+	}
+	ph.options.Store(&next)
+	return nil
+}
+
+func (ph *Phos[T]) opts() *Options {
+	return ph.options.Load()
+}
+
+// Results returns an iterator over the results of PHOS which stops after the last result
+// The Result with OK == false sent after Close will not be yielded, so it works with or without WithCloseOut
+//
+//	ph.Results()(func(res Result[T]) bool {
+//		fmt.Println(res.Data)
+//		return true
+//	})
+func (ph *Phos[T]) Results() func(yield func(Result[T]) bool) {
+	return func(yield func(Result[T]) bool) {
+		for res := range ph.Out {
+			if !res.OK || !yield(res) {
+				return
+			}
+		}
+	}
+}
+
 // Append add handler for PHOS to execute
+// Note: The handler chain is modified synchronously, the data in handling will finish on the old chain
 func (ph *Phos[T]) Append(handlers ...Handler[T]) {
-	for _, handler := range handlers {
-		ph.appendC <- handler
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	ph.handlers = append(ph.handlers, handlers...)
+}
+
+// Swap replaces the whole handler chain atomically, the data in handling will finish on the old chain
+// and the following data will be handled by the new one, the old chain can be restored by Rollback
+// Note: The Windows in the old chain will not fire into the new chain, their aggregated data will be reported with ErrChainChanged
+func (ph *Phos[T]) Swap(handlers ...Handler[T]) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	ph.version++
+	ph.previous = ph.handlers
+	ph.handlers = append(make([]Handler[T], 0, len(handlers)), handlers...)
+}
+
+// Rollback restores the handler chain replaced by the last Swap, ErrNoPrevious will be returned
+// if there is no Swap or it has been rolled back
+func (ph *Phos[T]) Rollback() error {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if ph.previous == nil {
+		return ErrNoPrevious
 	}
+	ph.version++
+	ph.handlers, ph.previous = ph.previous, nil
+	return nil
 }
 
 // Delete handler according to the index
+// Note: The handler chain is modified synchronously, the data in handling will finish on the old chain
 func (ph *Phos[T]) Delete(index int) {
-	ph.deleteC <- index
+	ph.delete(index)
 }
 
 // Remove handler from PHOS
@@ -112,76 +366,327 @@ func (ph *Phos[T]) Remove(index int) {
 	ph.Delete(index)
 }
 
-func (ph *Phos[T]) handle(in chan T, out chan Result[T]) {
+// AsHandler turns PHOS into a Handler so that it can be appended to another PHOS
+// The handler chain of PHOS will be executed with its own options (timeout, error funcs, zero),
+// and the Error returned by the chain will be propagated to the outer PHOS with its ErrorType unchanged
+// Note: PHOS is still running in the background, you should Close it when it is no longer used,
+// ErrClosed will be returned by the Handler after Close,
+// and the late result of the execution (see WithLate) has Seq 0 because the data is not sent via In
+func (ph *Phos[T]) AsHandler() Handler[T] {
+	return func(ctx context.Context, input T) (T, error) {
+		// Note: the in-flight chain is counted before Close waits for it
+		ph.sendMu.RLock()
+		select {
+		case <-ph.stopC:
+			ph.sendMu.RUnlock()
+			return input, ErrClosed
+		default:
+		}
+		ph.wg.Add(1)
+		ph.sendMu.RUnlock()
+		defer ph.wg.Done()
+		res := ph.run(ctx, &item[T]{data: input})
+		if res.skip {
+			return res.Data, ErrSkip
+		}
+		if res.Err != nil {
+			return res.Data, res.Err
+		}
+		return res.Data, nil
+	}
+}
+
+// inject pushes the data into the queue to be handled from the start index of the given version of the handler chain,
+// done will be called when the data is finished
+// Note: The data will be accepted even if the queue is full or closed
+func (ph *Phos[T]) inject(data T, start int, version uint64, done func()) {
+	ph.queue.inject(&item[T]{
+		data:    data,
+		start:   start,
+		version: version,
+		done:    done,
+	})
+}
+
+// addFlusher adds the function which will be called when PHOS is closing and the queue has been drained,
+// it returns true if any data is flushed into the queue
+func (ph *Phos[T]) addFlusher(fn func() bool) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	ph.flushers = append(ph.flushers, fn)
+}
+
+func (ph *Phos[T]) flush() bool {
+	ph.mu.RLock()
+	flushers := ph.flushers
+	ph.mu.RUnlock()
+	flushed := false
+	for _, fn := range flushers {
+		if fn() {
+			flushed = true
+		}
+	}
+	return flushed
+}
+
+// delete returns false if the index is out of range
+func (ph *Phos[T]) delete(index int) bool {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if index < 0 || index > len(ph.handlers)-1 {
+		return false
+	}
+	ph.version++
+	// Note: copy on write, the handlers may still be used by the running chain
+	ph.handlers = slices.Delete(slices.Clone(ph.handlers), index, index+1)
+	return true
+}
+
+func (ph *Phos[T]) handle() {
 	defer close(ph.closeC)
-	ctx := ph.options.Ctx
-LOOP:
+	var (
+		tickC <-chan time.Time
+		reqC  chan chan error
+	)
+	if ph.checkpointer != nil {
+		tickC, reqC = ph.checkpointer.tickC(), ph.checkpointer.reqC
+	}
 	for {
 		select {
-		case handler, ok := <-ph.appendC:
-			if !ok {
-				break LOOP
-			}
-			ph.handlers = append(ph.handlers, handler)
-		case index, ok := <-ph.deleteC:
-			if !ok {
-				break LOOP
-			}
-			if index < 0 || index > len(ph.handlers)-1 {
+		case <-tickC:
+			ph.reportCheckpoint(ph.checkpoint())
+		case errC := <-reqC:
+			errC <- ph.checkpoint()
+		default:
+		}
+		ph.reportDrops()
+		if ph.acker != nil {
+			ph.acker.drain()
+		}
+		// Note: PHOS will not take data from the queue when paused
+		if !ph.Paused() {
+			if it, ok := ph.queue.pop(); ok {
+				ph.process(it)
 				continue
 			}
-			ph.handlers = slices.Delete(ph.handlers, index, index+1)
-		case data, ok := <-in:
-			if !ok {
-				out <- ph.result(data, false, nil)
-				break LOOP
-			}
-			timer := time.NewTimer(ph.options.Timeout)
-			now := time.Now()
-			go ph.doHandle(ctx, data, now)
-			select {
-			case <-timer.C:
-				timer.Stop()
-				if ph.options.ErrTimeoutFunc != nil {
-					data = ph.options.ErrTimeoutFunc(ctx, data).(T)
-				}
-				out <- ph.result(data, true, timeoutError())
-			case res, ok := <-ph.receiveC:
-				timer.Stop()
-				if !ok {
-					break LOOP
+			if ph.queue.done() {
+				// Note: the flushed data will be pushed into the queue, so flush until nothing is flushed
+				ph.pending.Wait()
+				ph.reportDrops()
+				if ph.acker != nil {
+					ph.acker.drain()
 				}
-				out <- res
-			case <-ctx.Done():
-				timer.Stop()
-				if ph.options.ErrDoneFunc != nil {
-					data = ph.options.ErrDoneFunc(ctx, data, ctx.Err()).(T)
+				if ph.queue.done() && !ph.flush() {
+					break
 				}
-				out <- ph.result(data, true, ctxError(ctx.Err()))
+				continue
 			}
 		}
+		select {
+		case <-ph.wakeC:
+		case <-ph.queue.readyC:
+		case <-tickC:
+			ph.reportCheckpoint(ph.checkpoint())
+		case errC := <-reqC:
+			errC <- ph.checkpoint()
+		}
+	}
+	if ph.partitions != nil {
+		ph.partitions.close()
+		ph.workerWg.Wait()
 	}
+	if ph.acker != nil {
+		ph.acker.close()
+	}
+	if ph.checkpointer != nil {
+		if ph.checkpointer.ticker != nil {
+			ph.checkpointer.ticker.Stop()
+		}
+		ph.reportCheckpoint(ph.checkpoint())
+	}
+	if ph.wal != nil {
+		_ = ph.wal.Close()
+	}
+	if !ph.opts().CloseOut {
+		ph.emit(ph.result(ph.opts(), *new(T), false, nil))
+	}
+	ph.closeSubscribers()
 	ph.wg.Wait()
+	if ph.late != nil {
+		close(ph.late)
+	}
+	if ph.opts().CloseOut {
+		close(ph.out)
+	}
+}
+
+// process handles the item in place or dispatches it to the partition of its key
+func (ph *Phos[T]) process(it *item[T]) {
+	if ph.partitions == nil {
+		ph.execute(it)
+		return
+	}
+	it.key = ph.opts().KeyFunc(it.data)
+	ph.pending.Add(1)
+	ph.partitions.dispatch(it)
 }
 
-func (ph *Phos[T]) doHandle(ctx context.Context, data T, past time.Time) {
+// execute handles the item and emits the result
+func (ph *Phos[T]) execute(it *item[T]) {
+	if ph.aborted.Load() {
+		ph.abandoned.Add(1)
+		return
+	}
+	ctx := ph.ctx
+	if ph.partitions != nil {
+		ctx = withState(ctx, ph.opts().StateStore, it.key)
+	}
+	if it.metadata != nil {
+		ctx = WithMetadata(ctx, it.metadata)
+	}
+	res := ph.run(ctx, it)
+	res.Seq = it.seq
+	if res.skip {
+		ph.finish(it)
+		return
+	}
+	if ph.aborted.Load() && res.Err != nil && res.Err.Type == CtxErr {
+		ph.abandoned.Add(1)
+		// Note: the abandoned data will be replayed from the WAL
+		ph.emit(res)
+		return
+	}
+	if ph.acker != nil {
+		ph.acker.deliver(it, res)
+		return
+	}
+	if !ph.emit(res) {
+		// Note: the result is not received, the data will be replayed from the WAL
+		ph.abandoned.Add(1)
+		return
+	}
+	// Note: the data is not in the WAL, the WAL implies Ack which defers this until the result is consumed
+	ph.finish(it)
+}
+
+// finish marks the item done in the WAL and the checkpoint
+func (ph *Phos[T]) finish(it *item[T]) {
+	if it.done != nil {
+		it.done()
+	}
+	if it.seq == 0 {
+		return
+	}
+	if ph.wal != nil {
+		_ = ph.wal.done(it.seq)
+	}
+	if ph.checkpointer != nil {
+		ph.checkpointer.finish(it.seq)
+	}
+}
+
+// run executes the handler chain from the start index of the item and waits for the result until timeout or ctx done
+// The deadline of the item replaces the timeout if WithItemDeadline is enabled
+func (ph *Phos[T]) run(ctx context.Context, it *item[T]) Result[T] {
+	// Note: the options are loaded once so that Update takes effect for the next data
+	options := ph.opts()
+	var (
+		cctx   context.Context
+		cancel context.CancelFunc
+		cause  = ErrTimeout
+	)
+	switch {
+	case options.ItemDeadline && !it.deadline.IsZero():
+		cctx, cancel = context.WithDeadline(ctx, it.deadline)
+		cause = ErrDeadline
+	case options.Timeout > 0:
+		cctx, cancel = context.WithTimeout(ctx, options.Timeout)
+	default:
+		// Note: no timer is created without timeout
+		cctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	done := make(chan Result[T], 1)
+	// claimed decides whether the result of the chain or the timeout is delivered
+	claimed := &atomic.Bool{}
+	it.chainC = make(chan struct{})
+	ph.wg.Add(1)
+	go ph.doHandle(cctx, options, it, ph.clone(options, it.data), claimed, done)
+	select {
+	case res := <-done:
+		return res
+	case <-cctx.Done():
+		if !claimed.CompareAndSwap(false, true) {
+			// Note: the chain has finished at the same time
+			return <-done
+		}
+		data := it.data
+		if err := ctx.Err(); err != nil {
+			if options.ErrDoneFunc != nil {
+				data = options.ErrDoneFunc(ctx, data, err).(T)
+			}
+			return ph.result(options, data, true, ctxError(err))
+		}
+		if options.ErrTimeoutFunc != nil {
+			data = options.ErrTimeoutFunc(ctx, data).(T)
+		}
+		return ph.result(options, data, true, timeoutError(cause))
+	}
+}
+
+func (ph *Phos[T]) doHandle(ctx context.Context, options *Options, it *item[T], data T, claimed *atomic.Bool, done chan<- Result[T]) {
+	defer ph.wg.Done()
+	defer close(it.chainC)
 	launch := func(err *Error) {
-		if time.Now().After(past.Add(ph.options.Timeout)) {
+		res := ph.result(options, data, true, err)
+		res.Seq = it.seq
+		// Note: the result is late if the chain has timed out or ctx done
+		if ctx.Err() == nil && claimed.CompareAndSwap(false, true) {
+			done <- res
 			return
 		}
-		select {
-		case ph.receiveC <- ph.result(data, true, err):
-		default:
+		ph.reportLate(res)
+	}
+	if ph.limiter != nil {
+		if err := ph.limiter.wait(ctx); err != nil {
+			var phErr *Error
+			if errors.As(err, &phErr) {
+				launch(phErr)
+			}
+			return
 		}
 	}
-	ph.wg.Add(1)
-	defer ph.wg.Done()
+	ph.mu.RLock()
+	handlers, version := ph.handlers, ph.version
+	ph.mu.RUnlock()
+	if it.start > 0 && it.version != version {
+		// Note: the index of the injected item is meaningless in the changed handler chain
+		launch(handlerError(ErrChainChanged))
+		return
+	}
+	info := &chainInfo[T]{ph: ph, version: version}
+	ctx = context.WithValue(ctx, chainKey{}, info)
 	var err error
-	for _, handler := range ph.handlers {
-		data, err = handler(ctx, data)
+	for i := min(it.start, len(handlers)); i < len(handlers); i++ {
+		if i > it.start && options.PauseInFlight && !ph.waitResume(ctx) {
+			return
+		}
+		info.index = i
+		data, err = handlers[i](ctx, data)
+		if errors.Is(err, ErrSkip) {
+			if ctx.Err() == nil && claimed.CompareAndSwap(false, true) {
+				done <- Result[T]{skip: true}
+			}
+			return
+		}
 		if err != nil {
-			if ph.options.ErrHandleFunc != nil {
-				data = ph.options.ErrHandleFunc(ctx, data, err).(T)
+			if options.ErrHandleFunc != nil {
+				data = options.ErrHandleFunc(ctx, data, err).(T)
+			}
+			var phErr *Error
+			if errors.As(err, &phErr) {
+				launch(phErr)
+				return
 			}
 			launch(handlerError(err))
 			return
@@ -190,8 +695,20 @@ func (ph *Phos[T]) doHandle(ctx context.Context, data T, past time.Time) {
 	launch(nil)
 }
 
-func (ph *Phos[T]) result(data T, ok bool, err *Error) Result[T] {
-	if ph.options.Zero && err != nil {
+// clone returns the copy of data for the handler chain by CloneFunc or Cloner, or data itself if neither is available
+func (ph *Phos[T]) clone(options *Options, data T) T {
+	if options.CloneFunc != nil {
+		return options.CloneFunc(data).(T)
+	}
+	if c, ok := any(data).(Cloner[T]); ok {
+		return c.Clone()
+	}
+	return data
+}
+
+// result builds the Result with the options snapshot of the data, so that Update does not take effect halfway
+func (ph *Phos[T]) result(options *Options, data T, ok bool, err *Error) Result[T] {
+	if options.Zero && err != nil {
 		return Result[T]{
 			Data: *new(T),
 			OK:   ok,
@@ -18,6 +18,7 @@ package phos
 import (
 	"context"
 	"errors"
+	"maps"
 	"testing"
 	"time"
 
@@ -49,6 +50,94 @@ func TestClose(t *testing.T) {
 	assert.Nil(t, res.Err)
 }
 
+func TestCloseOut(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithCloseOut())
+	ph.Append(plusOne)
+	ph.In <- 10
+	ph.In <- 20
+	go ph.Close()
+	var data []int
+	for res := range ph.Out {
+		assert.True(t, res.OK)
+		data = append(data, res.Data)
+	}
+	assert.Equal(t, []int{11, 21}, data)
+}
+
+func TestResults(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	ph.In <- 10
+	ph.In <- 20
+	go ph.Close()
+	var data []int
+	ph.Results()(func(res Result[int]) bool {
+		data = append(data, res.Data)
+		return true
+	})
+	assert.Equal(t, []int{11, 21}, data)
+}
+
+func TestShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	ph.In <- 10
+	ph.In <- 20
+	results := make(chan []Result[int])
+	go func() {
+		var rs []Result[int]
+		for res := range ph.Out {
+			rs = append(rs, res)
+			if !res.OK {
+				break
+			}
+		}
+		results <- rs
+	}()
+	assert.Nil(t, ph.Shutdown(context.Background()))
+	rs := <-results
+	assert.Len(t, rs, 3)
+	assert.Equal(t, 11, rs[0].Data)
+	assert.Equal(t, 21, rs[1].Data)
+	assert.False(t, rs[2].OK)
+}
+
+func TestShutdownWithDeadline(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOneWithCtxSleep)
+	ph.In <- 10
+	ph.In <- 20
+	results := make(chan []Result[int])
+	go func() {
+		var rs []Result[int]
+		for res := range ph.Out {
+			rs = append(rs, res)
+			if !res.OK {
+				break
+			}
+		}
+		results <- rs
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := ph.Shutdown(ctx)
+	var shutdownErr *ShutdownError
+	assert.True(t, errors.As(err, &shutdownErr))
+	assert.Equal(t, 2, shutdownErr.Abandoned)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	rs := <-results
+	// Note:
+	// The in-flight data will be canceled and the buffered data will be dropped
+	assert.Len(t, rs, 2)
+	assert.Equal(t, 10, rs[0].Data)
+	assert.Equal(t, CtxErr, rs[0].Err.Type)
+	assert.False(t, rs[1].OK)
+}
+
 func TestMultiHandlers(t *testing.T) {
 	defer goleak.VerifyNone(t)
 	ph := New[int]()
@@ -315,6 +404,231 @@ func TestDelete(t *testing.T) {
 	assert.Nil(t, res3.Err)
 }
 
+func TestNoTimeout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithNoTimeout())
+	defer ph.Close()
+	ph.Append(func(ctx context.Context, data int) (int, error) {
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+		time.Sleep(20 * time.Millisecond)
+		return data + 1, nil
+	})
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Equal(t, 2, res.Data)
+	assert.Nil(t, res.Err)
+}
+
+func TestItemDeadline(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithItemDeadline(), WithTimeout(50*time.Millisecond))
+	defer ph.Close()
+	ph.Append(plusOneWithCtxSleep)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Nil(t, ph.SendContext(ctx, 1))
+	res := <-ph.Out
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, TimeoutErr, res.Err.Type)
+	assert.ErrorIs(t, res.Err, ErrDeadline)
+	// Note:
+	// The timeout is used for the data without deadline
+	ph.In <- 1
+	res = <-ph.Out
+	assert.Equal(t, TimeoutErr, res.Err.Type)
+	assert.ErrorIs(t, res.Err, ErrTimeout)
+}
+
+func TestLate(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithLate(1), WithTimeout(10*time.Millisecond))
+	ph.Append(func(ctx context.Context, data int) (int, error) {
+		time.Sleep(50 * time.Millisecond)
+		return data + 1, nil
+	})
+	ph.In <- 1
+	res := <-ph.Out
+	assert.Equal(t, TimeoutErr, res.Err.Type)
+	assert.Equal(t, uint64(1), res.Seq)
+	// Note:
+	// The late result reports the real outcome of the timed out chain
+	late := <-ph.Late()
+	assert.Equal(t, 2, late.Data)
+	assert.Nil(t, late.Err)
+	assert.Equal(t, res.Seq, late.Seq)
+	go ph.Close()
+	<-ph.Out
+	_, ok := <-ph.Late()
+	assert.False(t, ok)
+}
+
+type counter struct {
+	n int
+}
+
+func (c *counter) Clone() *counter {
+	return &counter{n: c.n}
+}
+
+func TestCloneFunc(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	releaseC := make(chan struct{})
+	ph := New[map[string]int](WithTimeout(10*time.Millisecond), WithLate(1), WithCloneFunc(func(data any) any {
+		return maps.Clone(data.(map[string]int))
+	}), WithErrTimeoutFunc(func(ctx context.Context, data any) any {
+		// Note:
+		// The data is not shared with the timed out chain which is still mutating its copy
+		m := data.(map[string]int)
+		m["timeout"]++
+		close(releaseC)
+		return m
+	}))
+	ph.Append(func(ctx context.Context, data map[string]int) (map[string]int, error) {
+		<-ctx.Done()
+		<-releaseC
+		data["chain"]++
+		return data, nil
+	})
+	ph.In <- map[string]int{}
+	res := <-ph.Out
+	assert.Equal(t, TimeoutErr, res.Err.Type)
+	assert.Equal(t, map[string]int{"timeout": 1}, res.Data)
+	assert.Equal(t, map[string]int{"chain": 1}, (<-ph.Late()).Data)
+	go ph.Close()
+	<-ph.Out
+}
+
+func TestCloner(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[*counter]()
+	defer ph.Close()
+	ph.Append(func(ctx context.Context, data *counter) (*counter, error) {
+		data.n++
+		return data, nil
+	})
+	input := &counter{n: 1}
+	ph.In <- input
+	res := <-ph.Out
+	assert.Equal(t, 2, res.Data.n)
+	assert.Equal(t, 1, input.n)
+}
+
+func TestSwap(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	defer ph.Close()
+	startC, releaseC := make(chan struct{}), make(chan struct{})
+	ph.Append(func(ctx context.Context, data int) (int, error) {
+		startC <- struct{}{}
+		<-releaseC
+		return data, nil
+	}, plusOne)
+	ph.In <- 10
+	<-startC
+	// Note:
+	// The data in handling finishes on the old chain
+	ph.Swap(plusThree)
+	close(releaseC)
+	res := <-ph.Out
+	assert.Equal(t, 11, res.Data)
+	ph.In <- 10 // 10 + 3 = 13
+	res = <-ph.Out
+	assert.Equal(t, 13, res.Data)
+	assert.Nil(t, ph.Rollback())
+	assert.Equal(t, 2, ph.Len())
+	assert.ErrorIs(t, ph.Rollback(), ErrNoPrevious)
+}
+
+func TestAsHandler(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	sub := New[int]()
+	defer sub.Close()
+	sub.Append(plusOne, plusThree)
+	ph := New[int]()
+	defer ph.Close()
+	ph.Append(plusOne, sub.AsHandler(), plusOne)
+	ph.In <- 10 // 10 + 1 + (1 + 3) + 1 = 16
+	res := <-ph.Out
+	assert.Equal(t, 16, res.Data)
+	assert.True(t, res.OK)
+	assert.Nil(t, res.Err)
+}
+
+func TestAsHandlerWithErr(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	sub := New[int](WithTimeout(100 * time.Millisecond))
+	defer sub.Close()
+	sub.Append(plusOneWithCtxSleep)
+	ph := New[int]()
+	defer ph.Close()
+	ph.Append(plusOne, sub.AsHandler(), plusOne)
+	// Note:
+	// The timeout error of the sub PHOS will be propagated to the outer PHOS
+	ph.In <- 10
+	res := <-ph.Out
+	assert.Equal(t, 11, res.Data)
+	assert.True(t, res.OK)
+	assert.Equal(t, TimeoutErr, res.Err.Type)
+	assert.Equal(t, "phos error timeout", res.Err.Error())
+	sub.Delete(0)
+	sub.Append(plusOneWithErr)
+	ph.In <- 10 // 10 + 1 + 111 = 122
+	res = <-ph.Out
+	assert.Equal(t, 122, res.Data)
+	assert.Equal(t, HandlerErr, res.Err.Type)
+	assert.Equal(t, "plus one error", res.Err.Error())
+}
+
+func TestAsHandlerClosed(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	sub := New[int]()
+	sub.Append(plusOne)
+	sub.Close()
+	ph := New[int]()
+	defer ph.Close()
+	ph.Append(plusOne, sub.AsHandler(), plusOne)
+	// Note:
+	// The closed sub PHOS will not run the handler chain
+	ph.In <- 10
+	res := <-ph.Out
+	assert.Equal(t, 11, res.Data)
+	assert.Equal(t, HandlerErr, res.Err.Type)
+	assert.ErrorIs(t, res.Err, ErrClosed)
+}
+
+func TestShutdownUnread(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	for i := 1; i <= 3; i++ {
+		ph.In <- i
+	}
+	assert.Eventually(t, func() bool {
+		return len(ph.Out) == 1
+	}, time.Second, time.Millisecond)
+	// Note:
+	// Out is not read, Shutdown returns after ctx is done and the unread results are abandoned
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- ph.Shutdown(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errC:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown is blocked by Out")
+	}
+	var shutdownErr *ShutdownError
+	assert.True(t, errors.As(err, &shutdownErr))
+	assert.Equal(t, 2, shutdownErr.Abandoned)
+	assert.Equal(t, 2, (<-ph.Out).Data)
+	assert.Zero(t, len(ph.Out))
+}
+
 func plusOne(_ context.Context, data int) (int, error) {
 	return data + 1, nil
 }
@@ -339,3 +653,12 @@ func plusOneWithSleep(_ context.Context, data int) (int, error) {
 	time.Sleep(time.Second * 6)
 	return data + 1, nil
 }
+
+func plusOneWithCtxSleep(ctx context.Context, data int) (int, error) {
+	select {
+	case <-ctx.Done():
+		return data, ctx.Err()
+	case <-time.After(time.Second * 6):
+	}
+	return data + 1, nil
+}
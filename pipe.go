@@ -0,0 +1,122 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import "sync"
+
+// PipeMode decides what to do with the error result of a stage in Pipeline
+type PipeMode uint64
+
+const (
+	// PipeStop stops the error result at the stage where the error happened,
+	// the result will be sent to the Out of Pipeline directly without passing through the remaining stages
+	PipeStop PipeMode = iota
+	// PipeForward forwards the data of the error result to the next stage as if no error happened
+	PipeForward
+	// PipeDivert diverts the error result to the Diverted channel of Pipeline
+	PipeDivert
+)
+
+// Pipeline connects the Out of each PHOS to the In of the next one
+type Pipeline[T any] struct {
+	// In is the In of the first PHOS
+	In chan<- T
+	// Out receives the results of the last PHOS and the stopped error results (PipeStop)
+	// Note: Same as PHOS, a Result with OK == false will be sent after Close
+	Out <-chan Result[T]
+	// Diverted receives the error results of all stages (PipeDivert), it will be closed after Close
+	// Note: You must consume Diverted when using PipeDivert, otherwise the Pipeline will be blocked
+	Diverted <-chan Result[T]
+
+	stages []*Phos[T]
+	mode   PipeMode
+
+	once  sync.Once
+	doneC chan struct{}
+}
+
+// Pipe connects the PHOS instances in order, the Out of each one will be forwarded to the In of the next one
+// Note: You should not send to the In or receive from the Out of the piped PHOS (except the In of the first one) manually
+func Pipe[T any](mode PipeMode, phs ...*Phos[T]) *Pipeline[T] {
+	if len(phs) == 0 {
+		panic("phos: Pipe requires at least one PHOS")
+	}
+	out := make(chan Result[T], 1)
+	diverted := make(chan Result[T], 1)
+	p := &Pipeline[T]{
+		In:       phs[0].In,
+		Out:      out,
+		Diverted: diverted,
+		stages:   phs,
+		mode:     mode,
+		doneC:    make(chan struct{}),
+	}
+	for i := 0; i < len(phs)-1; i++ {
+		go p.forward(phs[i], phs[i+1], out, diverted)
+	}
+	go p.collect(phs[len(phs)-1], out, diverted)
+	return p
+}
+
+// Close Pipeline
+// Each stage will be closed in order after all the results of the previous stage have been forwarded
+func (p *Pipeline[T]) Close() {
+	p.once.Do(func() {
+		p.stages[0].Close()
+		<-p.doneC
+	})
+}
+
+// forward the results of src to dst until src is closed, then close dst
+func (p *Pipeline[T]) forward(src, dst *Phos[T], out, diverted chan<- Result[T]) {
+	for {
+		res := <-src.Out
+		if !res.OK {
+			dst.Close()
+			return
+		}
+		if res.Err == nil {
+			dst.In <- res.Data
+			continue
+		}
+		switch p.mode {
+		case PipeForward:
+			dst.In <- res.Data
+		case PipeDivert:
+			diverted <- res
+		default:
+			out <- res
+		}
+	}
+}
+
+// collect the results of the last stage
+// Note: All the previous stages have exited when the last stage is closed
+func (p *Pipeline[T]) collect(last *Phos[T], out, diverted chan<- Result[T]) {
+	defer close(p.doneC)
+	for {
+		res := <-last.Out
+		if res.OK && res.Err != nil && p.mode == PipeDivert {
+			diverted <- res
+			continue
+		}
+		out <- res
+		if !res.OK {
+			close(diverted)
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func newStages() []*Phos[int] {
+	a, b, c := New[int](), New[int](), New[int]()
+	a.Append(plusOne)
+	b.Append(plusOneWithErr)
+	c.Append(plusThree)
+	return []*Phos[int]{a, b, c}
+}
+
+func TestPipe(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	a, b, c := New[int](), New[int](), New[int]()
+	a.Append(plusOne)
+	b.Append(plusOne)
+	c.Append(plusThree)
+	p := Pipe(PipeStop, a, b, c)
+	p.In <- 10 // 10 + 1 + 1 + 3 = 15
+	p.In <- 20 // 20 + 1 + 1 + 3 = 25
+	res1 := <-p.Out
+	res2 := <-p.Out
+	assert.Equal(t, 15, res1.Data)
+	assert.Equal(t, 25, res2.Data)
+	assert.True(t, res1.OK)
+	assert.True(t, res2.OK)
+	assert.Nil(t, res1.Err)
+	assert.Nil(t, res2.Err)
+	p.Close()
+	res, ok := <-p.Out
+	assert.True(t, ok)
+	assert.False(t, res.OK)
+	_, ok = <-p.Diverted
+	assert.False(t, ok)
+}
+
+func TestPipeStop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	p := Pipe(PipeStop, newStages()...)
+	p.In <- 10 // 10 + 1 + 111 = 122
+	res := <-p.Out
+	assert.Equal(t, 122, res.Data)
+	assert.True(t, res.OK)
+	assert.Equal(t, HandlerErr, res.Err.Type)
+	p.Close()
+	res = <-p.Out
+	assert.False(t, res.OK)
+}
+
+func TestPipeForward(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	p := Pipe(PipeForward, newStages()...)
+	p.In <- 10 // 10 + 1 + 111 + 3 = 125
+	res := <-p.Out
+	assert.Equal(t, 125, res.Data)
+	assert.True(t, res.OK)
+	assert.Nil(t, res.Err)
+	p.Close()
+	res = <-p.Out
+	assert.False(t, res.OK)
+}
+
+func TestPipeDivert(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	p := Pipe(PipeDivert, newStages()...)
+	p.In <- 10 // 10 + 1 + 111 = 122
+	res := <-p.Diverted
+	assert.Equal(t, 122, res.Data)
+	assert.True(t, res.OK)
+	assert.Equal(t, "plus one error", res.Err.Error())
+	p.Close()
+	res = <-p.Out
+	assert.False(t, res.OK)
+	_, ok := <-p.Diverted
+	assert.False(t, ok)
+}
@@ -0,0 +1,318 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy decides what to do when the queue of PHOS is full
+type OverflowPolicy uint64
+
+const (
+	// OverflowBlock blocks the sender until there is space in the queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject rejects the new data, ErrFull will be returned to TrySend and SendContext,
+	// and the data sent to In will be reported as dropped
+	OverflowReject
+	// OverflowDropNewest drops the new data
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest data in the queue
+	OverflowDropOldest
+	// OverflowDropLowest drops the data with the lowest priority (the newest one if there are several)
+	OverflowDropLowest
+)
+
+// item is the data accepted by PHOS
+type item[T any] struct {
+	data     T
+	priority int
+	enqueued time.Time
+	key      string
+	// start is the index of the handler to start with
+	start int
+	// version is the version of the handler chain which start belongs to
+	version uint64
+	// done is called when the injected item is finished
+	done func()
+	// chainC is closed when the handler chain of the item returns, even if it has timed out
+	chainC chan struct{}
+	// seq is the sequence number of the accepted data (in the WAL if enabled), 0 if the item is injected
+	seq uint64
+	// metadata is carried by the context of the sender, see WithMetadata
+	metadata map[string]string
+	// deadline is the deadline of the context of the sender, see WithItemDeadline
+	deadline time.Time
+}
+
+// queue buffers the accepted data before handling
+// Items with higher priority will be popped first, and the items with the same priority will be popped in FIFO order
+// Note: The queue is scanned linearly, it is designed for small queue sizes
+type queue[T any] struct {
+	mu     sync.Mutex
+	items  []*item[T]
+	size   int
+	policy OverflowPolicy
+	aging  time.Duration
+	closed bool
+	// readyC is signaled when an item is pushed or the queue is closed
+	readyC chan struct{}
+	// spaceC is closed and replaced when an item is popped or the queue is closed
+	spaceC chan struct{}
+}
+
+func newQueue[T any](size int, policy OverflowPolicy, aging time.Duration) *queue[T] {
+	if size < 1 {
+		size = 1
+	}
+	return &queue[T]{
+		items:  make([]*item[T], 0, size),
+		size:   size,
+		policy: policy,
+		aging:  aging,
+		readyC: make(chan struct{}, 1),
+		spaceC: make(chan struct{}),
+	}
+}
+
+// push adds the item according to the overflow policy and returns the item dropped by the policy
+// If the queue is full with OverflowBlock, ErrFull and a channel to wait for space will be returned
+func (q *queue[T]) push(it *item[T]) (*item[T], <-chan struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, nil, ErrClosed
+	}
+	it.enqueued = time.Now()
+	if len(q.items) < q.size {
+		q.add(it)
+		return nil, nil, nil
+	}
+	switch q.policy {
+	case OverflowReject:
+		return nil, nil, ErrFull
+	case OverflowDropNewest:
+		return it, nil, nil
+	case OverflowDropOldest:
+		dropped := q.items[0]
+		q.items = append(q.items[:0], q.items[1:]...)
+		q.add(it)
+		return dropped, nil, nil
+	case OverflowDropLowest:
+		now := it.enqueued
+		lowest := 0
+		for i, v := range q.items {
+			if q.effective(v, now) <= q.effective(q.items[lowest], now) {
+				lowest = i
+			}
+		}
+		dropped := q.items[lowest]
+		if it.priority <= q.effective(dropped, now) {
+			return it, nil, nil
+		}
+		q.items = slices.Delete(q.items, lowest, lowest+1)
+		q.add(it)
+		return dropped, nil, nil
+	default:
+		return nil, q.spaceC, ErrFull
+	}
+}
+
+func (q *queue[T]) add(it *item[T]) {
+	q.items = append(q.items, it)
+	select {
+	case q.readyC <- struct{}{}:
+	default:
+	}
+}
+
+// inject adds the item ignoring the size and the closed state of the queue
+func (q *queue[T]) inject(it *item[T]) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	it.enqueued = time.Now()
+	q.add(it)
+}
+
+// broadcast wakes up all the senders waiting for space
+func (q *queue[T]) broadcast() {
+	close(q.spaceC)
+	q.spaceC = make(chan struct{})
+}
+
+// effective returns the priority of the item raised by one for every aging duration it has waited,
+// so that the items with low priority will not be starved
+func (q *queue[T]) effective(it *item[T], now time.Time) int {
+	if q.aging <= 0 {
+		return it.priority
+	}
+	return it.priority + int(now.Sub(it.enqueued)/q.aging)
+}
+
+// pop removes and returns the item with the highest effective priority
+func (q *queue[T]) pop() (*item[T], bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	now := time.Now()
+	highest := 0
+	for i, v := range q.items {
+		if q.effective(v, now) > q.effective(q.items[highest], now) {
+			highest = i
+		}
+	}
+	it := q.items[highest]
+	q.items = slices.Delete(q.items, highest, highest+1)
+	q.broadcast()
+	return it, true
+}
+
+// close the queue, the items in the queue can still be popped
+func (q *queue[T]) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.broadcast()
+	select {
+	case q.readyC <- struct{}{}:
+	default:
+	}
+}
+
+// done reports whether the queue is closed and empty
+func (q *queue[T]) done() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed && len(q.items) == 0
+}
+
+func (q *queue[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// depth returns the number of items of each priority
+func (q *queue[T]) depth() map[int]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	depth := make(map[int]int)
+	for _, it := range q.items {
+		depth[it.priority]++
+	}
+	return depth
+}
+
+// enqueue pushes the item into the queue, the item dropped by the overflow policy will be reported
+// If wait is true, it blocks until there is space in the queue (OverflowBlock), ctx is done or stopC is closed
+// The item will be logged in the WAL before pushed, and marked done if it is not accepted
+func (ph *Phos[T]) enqueue(ctx context.Context, it *item[T], wait bool, stopC <-chan struct{}) (err error) {
+	next := func() (uint64, error) {
+		if ph.wal != nil {
+			return ph.wal.append(it.data)
+		}
+		return ph.seq.Add(1), nil
+	}
+	if ph.checkpointer != nil {
+		it.seq, err = ph.checkpointer.assign(next)
+	} else {
+		it.seq, err = next()
+	}
+	if err != nil {
+		return err
+	}
+	it.metadata = MetadataFrom(ctx)
+	it.deadline, _ = ctx.Deadline()
+	defer func() {
+		if err != nil {
+			ph.finish(it)
+			return
+		}
+		if ph.recorder != nil {
+			ph.recorder.record(it)
+		}
+	}()
+	for {
+		dropped, spaceC, err := ph.queue.push(it)
+		if dropped != nil {
+			ph.drop(dropped)
+		}
+		if err == nil || spaceC == nil || !wait {
+			return err
+		}
+		select {
+		case <-spaceC:
+		case <-stopC:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pump moves the data sent to In into the queue until In is closed
+func (ph *Phos[T]) pump(in <-chan T) {
+	defer ph.queue.close()
+	for data := range in {
+		it := &item[T]{data: data}
+		if err := ph.enqueue(context.Background(), it, true, nil); err != nil {
+			// Note: there is no sender to return the error to when rejected
+			ph.drop(it)
+		}
+	}
+}
+
+// drop counts the dropped item and hands it over to the handle loop to be reported
+// Note: the sender (e.g. TrySend) must not be blocked by reporting the dropped data to Out
+func (ph *Phos[T]) drop(it *item[T]) {
+	ph.dropped.Add(1)
+	ph.dropMu.Lock()
+	ph.drops = append(ph.drops, it)
+	ph.dropMu.Unlock()
+	ph.wake()
+}
+
+// reportDrops reports the dropped items to ErrDropFunc or Out, it is called by the handle loop
+func (ph *Phos[T]) reportDrops() {
+	ph.dropMu.Lock()
+	drops := ph.drops
+	ph.drops = nil
+	ph.dropMu.Unlock()
+	for _, it := range drops {
+		ph.report(it)
+	}
+}
+
+// report the dropped item to ErrDropFunc or Out
+func (ph *Phos[T]) report(it *item[T]) {
+	defer ph.finish(it)
+	options := ph.opts()
+	if fn := options.ErrDropFunc; fn != nil {
+		fn(ph.ctx, it.data)
+		return
+	}
+	res := ph.result(options, it.data, true, droppedError())
+	res.Seq = it.seq
+	ph.emit(res)
+}
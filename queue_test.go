@@ -0,0 +1,153 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestQueue(t *testing.T) {
+	q := newQueue[int](2, OverflowDropLowest, 0)
+	_, _, err := q.push(&item[int]{data: 1, priority: 1})
+	assert.Nil(t, err)
+	_, _, err = q.push(&item[int]{data: 2, priority: 2})
+	assert.Nil(t, err)
+	// Note:
+	// The new data has the lowest priority, so it will be dropped
+	dropped, _, err := q.push(&item[int]{data: 3, priority: 0})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, dropped.data)
+	dropped, _, err = q.push(&item[int]{data: 4, priority: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, dropped.data)
+	assert.Equal(t, 2, q.len())
+	assert.Equal(t, map[int]int{2: 1, 3: 1}, q.depth())
+	// Note:
+	// The data with higher priority will be popped first
+	it, ok := q.pop()
+	assert.True(t, ok)
+	assert.Equal(t, 4, it.data)
+	q.close()
+	assert.False(t, q.done())
+	_, _, err = q.push(&item[int]{data: 5})
+	assert.ErrorIs(t, err, ErrClosed)
+	it, _ = q.pop()
+	assert.Equal(t, 2, it.data)
+	assert.True(t, q.done())
+}
+
+func TestQueueAging(t *testing.T) {
+	q := newQueue[int](3, OverflowBlock, 10*time.Millisecond)
+	_, _, _ = q.push(&item[int]{data: 1, priority: 0})
+	time.Sleep(50 * time.Millisecond)
+	_, _, _ = q.push(&item[int]{data: 2, priority: 2})
+	_, _, _ = q.push(&item[int]{data: 3, priority: 0})
+	// Note:
+	// The first data has waited for more than 2 aging durations, so it has the highest effective priority
+	it, _ := q.pop()
+	assert.Equal(t, 1, it.data)
+	it, _ = q.pop()
+	assert.Equal(t, 2, it.data)
+	it, _ = q.pop()
+	assert.Equal(t, 3, it.data)
+}
+
+func TestSendPriority(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(3))
+	ph.Append(plusOne)
+	ph.Pause()
+	ctx := context.Background()
+	assert.Nil(t, ph.SendPriority(ctx, 10, 0))
+	assert.Nil(t, ph.SendPriority(ctx, 20, 5))
+	assert.Nil(t, ph.SendPriority(ctx, 30, 1))
+	assert.Equal(t, map[int]int{0: 1, 1: 1, 5: 1}, ph.Stats().QueueDepth)
+	go ph.Close()
+	assert.Equal(t, 21, (<-ph.Out).Data)
+	assert.Equal(t, 31, (<-ph.Out).Data)
+	assert.Equal(t, 11, (<-ph.Out).Data)
+	assert.False(t, (<-ph.Out).OK)
+}
+
+func TestOverflowReject(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(2), WithOverflow(OverflowReject))
+	ph.Append(plusOne)
+	ph.Pause()
+	assert.Nil(t, ph.TrySend(1))
+	assert.Nil(t, ph.SendContext(context.Background(), 2))
+	assert.ErrorIs(t, ph.TrySend(3), ErrFull)
+	assert.ErrorIs(t, ph.SendContext(context.Background(), 3), ErrFull)
+	assert.Equal(t, 2, ph.Stats().Queued)
+	go ph.Close()
+	assert.Equal(t, 2, (<-ph.Out).Data)
+	assert.Equal(t, 3, (<-ph.Out).Data)
+	assert.False(t, (<-ph.Out).OK)
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	var mu sync.Mutex
+	var dropped []int
+	ph := New[int](WithQueueSize(2), WithOverflow(OverflowDropNewest), WithErrDropFunc(func(_ context.Context, data any) {
+		mu.Lock()
+		defer mu.Unlock()
+		dropped = append(dropped, data.(int))
+	}))
+	ph.Append(plusOne)
+	ph.Pause()
+	assert.Nil(t, ph.TrySend(1))
+	assert.Nil(t, ph.TrySend(2))
+	assert.Nil(t, ph.TrySend(3))
+	assert.Equal(t, uint64(1), ph.Stats().Dropped)
+	go ph.Close()
+	assert.Equal(t, 2, (<-ph.Out).Data)
+	assert.Equal(t, 3, (<-ph.Out).Data)
+	assert.False(t, (<-ph.Out).OK)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{3}, dropped)
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(2), WithOverflow(OverflowDropOldest))
+	ph.Append(plusOne)
+	ph.Pause()
+	assert.Nil(t, ph.TrySend(1))
+	assert.Nil(t, ph.TrySend(2))
+	// Note:
+	// TrySend will not be blocked by reporting the dropped data even if Out is full,
+	// the dropped data is reported to Out with DroppedErr by PHOS
+	assert.Nil(t, ph.TrySend(3))
+	assert.Nil(t, ph.TrySend(4))
+	res := <-ph.Out
+	assert.Equal(t, 1, res.Data)
+	assert.Equal(t, DroppedErr, res.Err.Type)
+	res = <-ph.Out
+	assert.Equal(t, 2, res.Data)
+	assert.Equal(t, DroppedErr, res.Err.Type)
+	go ph.Close()
+	assert.Equal(t, 4, (<-ph.Out).Data)
+	assert.Equal(t, 5, (<-ph.Out).Data)
+	assert.False(t, (<-ph.Out).OK)
+}
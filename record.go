@@ -0,0 +1,181 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type metadataKey struct{}
+
+// WithMetadata returns a context carrying the metadata of the data sent by SendContext or SendPriority,
+// the metadata will be recorded by Recorder and can be accessed by MetadataFrom in handlers
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFrom returns the metadata of the data in handling, nil if there is no metadata
+func MetadataFrom(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// Record is a data accepted by PHOS
+type Record struct {
+	Time     time.Time         `json:"time"`
+	Priority int               `json:"priority,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Data     []byte            `json:"data"`
+}
+
+// Recorder writes the data accepted by PHOS to w as JSON lines of Record
+type Recorder[T any] struct {
+	codec Codec[T]
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder returns a Recorder which writes to w
+func NewRecorder[T any](w io.Writer, codec Codec[T]) *Recorder[T] {
+	return &Recorder[T]{
+		codec: codec,
+		enc:   json.NewEncoder(w),
+	}
+}
+
+// Err returns the first error of recording, the following data will not be recorded after an error
+func (r *Recorder[T]) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder[T]) record(it *item[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	b, err := r.codec.Marshal(it.data)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.err = r.enc.Encode(Record{
+		Time:     it.enqueued,
+		Priority: it.priority,
+		Metadata: it.metadata,
+		Data:     b,
+	})
+}
+
+// Replay sends the data recorded by Recorder to PHOS in order with their priority and metadata
+// The intervals between the data are kept at speed times the original speed, or ignored if speed <= 0
+// Note: Replay does not close PHOS, the results should be received from Out as usual
+func Replay[T any](ctx context.Context, ph *Phos[T], r io.Reader, codec Codec[T], speed float64) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	var (
+		first time.Time
+		start = time.Now()
+	)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return err
+		}
+		data, err := codec.Unmarshal(rec.Data)
+		if err != nil {
+			return err
+		}
+		if first.IsZero() {
+			first = rec.Time
+		}
+		if speed > 0 {
+			wait := time.Duration(float64(rec.Time.Sub(first))/speed) - time.Since(start)
+			if err = sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+		sctx := ctx
+		if rec.Metadata != nil {
+			sctx = WithMetadata(ctx, rec.Metadata)
+		}
+		if err = ph.SendPriority(sctx, data, rec.Priority); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ResultDiff is a difference between two Result streams at Index
+// Note: Want or Got is nil if the stream is shorter than the other one
+type ResultDiff[T any] struct {
+	Index int
+	Want  *Result[T]
+	Got   *Result[T]
+}
+
+// DiffResults compares the Data, OK and Err (type and message) of the results in order
+func DiffResults[T any](want, got []Result[T]) []ResultDiff[T] {
+	var diffs []ResultDiff[T]
+	for i := 0; i < max(len(want), len(got)); i++ {
+		diff := ResultDiff[T]{Index: i}
+		if i < len(want) {
+			diff.Want = &want[i]
+		}
+		if i < len(got) {
+			diff.Got = &got[i]
+		}
+		if diff.Want != nil && diff.Got != nil && equalResult(*diff.Want, *diff.Got) {
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+func equalResult[T any](a, b Result[T]) bool {
+	if a.OK != b.OK || !reflect.DeepEqual(a.Data, b.Data) {
+		return false
+	}
+	if a.Err == nil || b.Err == nil {
+		return a.Err == nil && b.Err == nil
+	}
+	return a.Err.Type == b.Err.Type && a.Err.Err.Error() == b.Err.Err.Error()
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func double(ctx context.Context, data int) (int, error) {
+	if MetadataFrom(ctx)["double"] == "true" {
+		return data * 2, nil
+	}
+	return data, nil
+}
+
+func results(ph *Phos[int]) []Result[int] {
+	var res []Result[int]
+	ph.Results()(func(r Result[int]) bool {
+		res = append(res, r)
+		return true
+	})
+	return res
+}
+
+func TestRecordReplay(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	var buf bytes.Buffer
+	recorder := NewRecorder[int](&buf, JSONCodec[int]{})
+	ph := New[int](WithRecorder(recorder), WithQueueSize(4))
+	ph.Append(plusOne, double)
+	ctx := WithMetadata(context.Background(), map[string]string{"double": "true"})
+	assert.Nil(t, ph.SendContext(ctx, 1))
+	assert.Nil(t, ph.SendContext(context.Background(), 2))
+	ph.In <- 3
+	go ph.Close()
+	recorded := results(ph)
+	assert.Equal(t, 3, len(recorded))
+	assert.Equal(t, 4, recorded[0].Data)
+	assert.Nil(t, recorder.Err())
+
+	replayed := New[int](WithQueueSize(4))
+	replayed.Append(plusOne, double)
+	go func() {
+		assert.Nil(t, Replay[int](context.Background(), replayed, &buf, JSONCodec[int]{}, 0))
+		replayed.Close()
+	}()
+	assert.Empty(t, DiffResults(recorded, results(replayed)))
+}
+
+func TestReplaySpeed(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	var buf bytes.Buffer
+	now := time.Now()
+	enc := json.NewEncoder(&buf)
+	for i := 0; i < 2; i++ {
+		data, _ := JSONCodec[int]{}.Marshal(i)
+		assert.Nil(t, enc.Encode(Record{
+			Time: now.Add(time.Duration(i) * 200 * time.Millisecond),
+			Data: data,
+		}))
+	}
+	ph := New[int](WithQueueSize(4))
+	defer ph.Close()
+	start := time.Now()
+	// Note:
+	// The interval of 200ms is replayed in 100ms at double speed
+	assert.Nil(t, Replay[int](context.Background(), ph, &buf, JSONCodec[int]{}, 2))
+	assert.InDelta(t, 100*time.Millisecond, time.Since(start), float64(50*time.Millisecond))
+	<-ph.Out
+	<-ph.Out
+}
+
+func TestDiffResults(t *testing.T) {
+	want := []Result[int]{
+		{Data: 1, OK: true},
+		{Data: 2, OK: true, Err: handlerError(errors.New("err"))},
+		{Data: 3, OK: true},
+	}
+	got := []Result[int]{
+		{Data: 1, OK: true},
+		{Data: 2, OK: true, Err: timeoutError(ErrTimeout)},
+	}
+	diffs := DiffResults(want, got)
+	assert.Len(t, diffs, 2)
+	assert.Equal(t, 1, diffs[0].Index)
+	assert.Equal(t, 2, diffs[1].Index)
+	assert.Nil(t, diffs[1].Got)
+	assert.Empty(t, DiffResults(want, want))
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import "context"
+
+// Closed returns a channel which will be closed when PHOS starts closing (Close or Shutdown is called)
+func (ph *Phos[T]) Closed() <-chan struct{} {
+	return ph.stopC
+}
+
+// TrySend sends data to PHOS without blocking
+// ErrFull will be returned if the queue of PHOS is full (OverflowBlock or OverflowReject),
+// ErrClosed will be returned after Close
+func (ph *Phos[T]) TrySend(data T) error {
+	ph.sendMu.RLock()
+	defer ph.sendMu.RUnlock()
+	select {
+	case <-ph.stopC:
+		return ErrClosed
+	default:
+	}
+	return ph.enqueue(context.Background(), &item[T]{data: data}, false, nil)
+}
+
+// SendContext sends data to PHOS, it blocks until the data is accepted, ctx is done or PHOS is closed
+// ErrClosed will be returned after Close, ctx.Err() will be returned if ctx is done,
+// ErrFull will be returned if the queue of PHOS is full with OverflowReject
+func (ph *Phos[T]) SendContext(ctx context.Context, data T) error {
+	return ph.SendPriority(ctx, data, 0)
+}
+
+// SendPriority is the same as SendContext but sends data with priority
+// The data with higher priority will be handled first, see WithAging for starvation protection
+func (ph *Phos[T]) SendPriority(ctx context.Context, data T, priority int) error {
+	ph.sendMu.RLock()
+	defer ph.sendMu.RUnlock()
+	select {
+	case <-ph.stopC:
+		return ErrClosed
+	default:
+	}
+	return ph.enqueue(ctx, &item[T]{data: data, priority: priority}, true, ph.stopC)
+}
+
+// TryAppend is the same as Append but returns ErrClosed after Close
+func (ph *Phos[T]) TryAppend(handlers ...Handler[T]) error {
+	select {
+	case <-ph.stopC:
+		return ErrClosed
+	default:
+	}
+	ph.Append(handlers...)
+	return nil
+}
+
+// TryDelete is the same as Delete but returns ErrClosed after Close
+// and ErrOutOfRange if there is no handler at the index
+func (ph *Phos[T]) TryDelete(index int) error {
+	select {
+	case <-ph.stopC:
+		return ErrClosed
+	default:
+	}
+	if !ph.delete(index) {
+		return ErrOutOfRange
+	}
+	return nil
+}
+
+// stop closes In after all the safe senders have returned
+func (ph *Phos[T]) stop() {
+	close(ph.stopC)
+	ph.sendMu.Lock()
+	defer ph.sendMu.Unlock()
+	close(ph.in)
+}
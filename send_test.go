@@ -0,0 +1,101 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestTrySend(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	ctx := context.Background()
+	assert.Nil(t, ph.SendContext(ctx, 1))
+	assert.Nil(t, ph.SendContext(ctx, 2))
+	assert.Nil(t, ph.SendContext(ctx, 3))
+	// Note:
+	// Out is full of result 2, the loop is blocked on result 3 and In is full of data 3
+	assert.ErrorIs(t, ph.TrySend(4), ErrFull)
+	assert.Equal(t, 2, (<-ph.Out).Data)
+	assert.Equal(t, 3, (<-ph.Out).Data)
+	assert.Equal(t, 4, (<-ph.Out).Data)
+	go func() {
+		for res := range ph.Out {
+			if !res.OK {
+				return
+			}
+		}
+	}()
+	ph.Close()
+	assert.ErrorIs(t, ph.TrySend(5), ErrClosed)
+	assert.ErrorIs(t, ph.SendContext(ctx, 5), ErrClosed)
+}
+
+func TestSendContext(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	assert.Nil(t, ph.SendContext(context.Background(), 1))
+	assert.Nil(t, ph.SendContext(context.Background(), 2))
+	assert.Nil(t, ph.SendContext(context.Background(), 3))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, ph.SendContext(ctx, 4), context.DeadlineExceeded)
+	errC := make(chan error)
+	go func() {
+		errC <- ph.SendContext(context.Background(), 4)
+	}()
+	go func() {
+		for res := range ph.Out {
+			if !res.OK {
+				return
+			}
+		}
+	}()
+	ph.Close()
+	// Note:
+	// The blocked sender will either succeed or get ErrClosed, but never panic
+	err := <-errC
+	if err != nil {
+		assert.ErrorIs(t, err, ErrClosed)
+	}
+}
+
+func TestTryAppendAndTryDelete(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	assert.Nil(t, ph.TryAppend(plusOne, plusThree))
+	assert.Equal(t, 2, ph.Len())
+	assert.ErrorIs(t, ph.TryDelete(2), ErrOutOfRange)
+	assert.Nil(t, ph.TryDelete(1))
+	assert.Equal(t, 1, ph.Len())
+	select {
+	case <-ph.Closed():
+		t.Fatal("PHOS should not be closed")
+	default:
+	}
+	ph.Close()
+	<-ph.Closed()
+	assert.ErrorIs(t, ph.TryAppend(plusOne), ErrClosed)
+	assert.ErrorIs(t, ph.TryDelete(0), ErrClosed)
+	assert.Equal(t, 1, ph.Len())
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	_ StateStore  = (*MemoryStore)(nil)
+	_ Snapshotter = (*MemoryStore)(nil)
+	_ State       = (*keyedState)(nil)
+)
+
+// State is the state of the key of the data in handling
+type State interface {
+	// Get returns the value of name
+	Get(name string) (any, bool)
+	// Put sets the value of name, it will expire after ttl (never expire if ttl <= 0)
+	Put(name string, value any, ttl time.Duration)
+	// Delete the value of name
+	Delete(name string)
+}
+
+// StateStore stores the states of all keys, implement it to use a persistent backend
+type StateStore interface {
+	Get(key, name string) (any, bool)
+	Put(key, name string, value any, ttl time.Duration)
+	Delete(key, name string)
+}
+
+// Snapshotter is implemented by the StateStore which supports snapshot and restore
+type Snapshotter interface {
+	Snapshot() StateSnapshot
+	Restore(snapshot StateSnapshot)
+}
+
+// StateSnapshot is the snapshot of a StateStore, indexed by key and then by name
+type StateSnapshot map[string]map[string]StateEntry
+
+// StateEntry is a value in StateSnapshot
+type StateEntry struct {
+	Value any
+	// ExpireAt is the time when the value expires, zero means never
+	ExpireAt time.Time
+}
+
+type stateKey struct{}
+
+type keyedState struct {
+	store StateStore
+	key   string
+}
+
+// StateFrom returns the State of the key of the data in handling
+// Note: It returns nil if keyed partitioning (WithKeyFunc) is not enabled
+func StateFrom(ctx context.Context) State {
+	state, _ := ctx.Value(stateKey{}).(State)
+	return state
+}
+
+func withState(ctx context.Context, store StateStore, key string) context.Context {
+	return context.WithValue(ctx, stateKey{}, &keyedState{
+		store: store,
+		key:   key,
+	})
+}
+
+func (s *keyedState) Get(name string) (any, bool) {
+	return s.store.Get(s.key, name)
+}
+
+func (s *keyedState) Put(name string, value any, ttl time.Duration) {
+	s.store.Put(s.key, name, value, ttl)
+}
+
+func (s *keyedState) Delete(name string) {
+	s.store.Delete(s.key, name)
+}
+
+// sweepInterval is the number of Put between two sweeps of the expired values
+const sweepInterval = 1024
+
+// MemoryStore is an in-memory StateStore
+// The expired values are removed lazily when they are read and periodically when values are put
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries StateSnapshot
+	puts    int
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(StateSnapshot),
+	}
+}
+
+// Get returns the value of name of key
+func (s *MemoryStore) Get(key, name string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key][name]
+	if !ok {
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		s.delete(key, name)
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Put sets the value of name of key
+func (s *MemoryStore) Put(key, name string, value any, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	entry := StateEntry{
+		Value: value,
+	}
+	if ttl > 0 {
+		entry.ExpireAt = now.Add(ttl)
+	}
+	if s.entries[key] == nil {
+		s.entries[key] = make(map[string]StateEntry)
+	}
+	s.entries[key][name] = entry
+	if s.puts++; s.puts%sweepInterval == 0 {
+		s.sweep(now)
+	}
+}
+
+// Delete the value of name of key
+func (s *MemoryStore) Delete(key, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(key, name)
+}
+
+// Snapshot returns a copy of the values which have not expired
+func (s *MemoryStore) Snapshot() StateSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	snapshot := make(StateSnapshot, len(s.entries))
+	for key, names := range s.entries {
+		for name, entry := range names {
+			if entry.expired(now) {
+				continue
+			}
+			if snapshot[key] == nil {
+				snapshot[key] = make(map[string]StateEntry, len(names))
+			}
+			snapshot[key][name] = entry
+		}
+	}
+	return snapshot
+}
+
+// Restore replaces all the values with the snapshot
+func (s *MemoryStore) Restore(snapshot StateSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(StateSnapshot, len(snapshot))
+	for key, names := range snapshot {
+		s.entries[key] = make(map[string]StateEntry, len(names))
+		for name, entry := range names {
+			s.entries[key][name] = entry
+		}
+	}
+}
+
+func (s *MemoryStore) delete(key, name string) {
+	delete(s.entries[key], name)
+	if len(s.entries[key]) == 0 {
+		delete(s.entries, key)
+	}
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, names := range s.entries {
+		for name, entry := range names {
+			if entry.expired(now) {
+				s.delete(key, name)
+			}
+		}
+	}
+}
+
+func (e StateEntry) expired(now time.Time) bool {
+	return !e.ExpireAt.IsZero() && !now.Before(e.ExpireAt)
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	store.Put("a", "total", 1, 0)
+	store.Put("a", "session", "s1", 50*time.Millisecond)
+	store.Put("b", "total", 2, 0)
+	v, ok := store.Get("a", "total")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, ok = store.Get("a", "session")
+	assert.True(t, ok)
+	assert.Equal(t, "s1", v)
+	snapshot := store.Snapshot()
+	assert.Len(t, snapshot, 2)
+	time.Sleep(60 * time.Millisecond)
+	_, ok = store.Get("a", "session")
+	assert.False(t, ok)
+	store.Delete("b", "total")
+	_, ok = store.Get("b", "total")
+	assert.False(t, ok)
+	assert.Equal(t, StateSnapshot{"a": {"total": {Value: 1}}}, store.Snapshot())
+	store.Restore(StateSnapshot{"c": {"total": {Value: 3}}})
+	_, ok = store.Get("a", "total")
+	assert.False(t, ok)
+	v, _ = store.Get("c", "total")
+	assert.Equal(t, 3, v)
+}
+
+func TestStateFrom(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	assert.Nil(t, StateFrom(context.Background()))
+	store := NewMemoryStore()
+	ph := New[int](WithKeyFunc(parity), WithWorkers(2), WithStateStore(store))
+	defer ph.Close()
+	// Note:
+	// The handler outputs the running total of the data with the same key
+	ph.Append(func(ctx context.Context, data int) (int, error) {
+		state := StateFrom(ctx)
+		total, _ := state.Get("total")
+		sum, _ := total.(int)
+		sum += data
+		state.Put("total", sum, 0)
+		return sum, nil
+	})
+	var odd, even []int
+	for i := 1; i <= 4; i++ {
+		ph.In <- i
+		res := <-ph.Out
+		if i%2 == 1 {
+			odd = append(odd, res.Data)
+		} else {
+			even = append(even, res.Data)
+		}
+	}
+	assert.Equal(t, []int{1, 4}, odd)
+	assert.Equal(t, []int{2, 6}, even)
+	assert.Equal(t, StateSnapshot{
+		"0": {"total": {Value: 6}},
+		"1": {"total": {Value: 4}},
+	}, store.Snapshot())
+	assert.Same(t, store, ph.StateStore())
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import "time"
+
+// Stats of PHOS
+type Stats struct {
+	// Paused reports whether PHOS is paused
+	Paused bool
+	// PausedTime is the total time PHOS has spent paused, including the current pause
+	PausedTime time.Duration
+	// Pauses is the number of times PHOS has been paused
+	Pauses uint64
+	// Queued is the number of data waiting in the queue
+	Queued int
+	// QueueDepth is the number of data waiting in the queue of each priority
+	QueueDepth map[int]int
+	// Dropped is the number of data dropped by the overflow policy
+	Dropped uint64
+}
+
+// Stats returns a snapshot of the stats of PHOS
+func (ph *Phos[T]) Stats() Stats {
+	paused, pausedTime, pauses := ph.pauser.stats()
+	return Stats{
+		Paused:     paused,
+		PausedTime: pausedTime,
+		Pauses:     pauses,
+		Queued:     ph.queue.len(),
+		QueueDepth: ph.queue.depth(),
+		Dropped:    ph.dropped.Load(),
+	}
+}
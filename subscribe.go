@@ -0,0 +1,212 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import "sync"
+
+// SubscribePolicy decides what to do when the buffer of a subscriber is full
+type SubscribePolicy uint64
+
+const (
+	// SubscribeBlock blocks PHOS until the subscriber receives the result
+	SubscribeBlock SubscribePolicy = iota
+	// SubscribeDropOldest drops the oldest result in the buffer of the subscriber
+	SubscribeDropOldest
+	// SubscribeDropNewest drops the result which is being delivered
+	SubscribeDropNewest
+	// SubscribeDisconnect unsubscribes and closes the channel of the subscriber
+	SubscribeDisconnect
+)
+
+var defaultSubscribeOptions = SubscribeOptions{
+	Buffer: 16,
+	Policy: SubscribeBlock,
+}
+
+// SubscribeOption for Subscribe
+type SubscribeOption func(o *SubscribeOptions)
+
+// SubscribeOptions for Subscribe
+type SubscribeOptions struct {
+	Buffer int
+	Policy SubscribePolicy
+}
+
+type subscriber[T any] struct {
+	c      chan Result[T]
+	policy SubscribePolicy
+	// doneC is closed by Unsubscribe to cancel the blocked delivery, c is closed after the delivery returns
+	doneC chan struct{}
+	once  sync.Once
+	mu    sync.Mutex
+}
+
+func newSubscribeOptions(opts ...SubscribeOption) *SubscribeOptions {
+	options := &SubscribeOptions{
+		Buffer: defaultSubscribeOptions.Buffer,
+		Policy: defaultSubscribeOptions.Policy,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithSubscribeBuffer will set the buffer size of the subscriber channel
+func WithSubscribeBuffer(size int) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.Buffer = size
+	}
+}
+
+// WithSubscribePolicy will set the policy which will be used when the buffer of the subscriber is full
+func WithSubscribePolicy(policy SubscribePolicy) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.Policy = policy
+	}
+}
+
+// Subscribe returns a channel which receives every result of PHOS, including the result with OK == false after Close
+// (unless WithCloseOut is enabled)
+// The channel will be closed after Unsubscribe or Close
+// Note: Out still receives every result, you must consume it as before
+func (ph *Phos[T]) Subscribe(opts ...SubscribeOption) <-chan Result[T] {
+	options := newSubscribeOptions(opts...)
+	sub := &subscriber[T]{
+		c:      make(chan Result[T], options.Buffer),
+		policy: options.Policy,
+		doneC:  make(chan struct{}),
+	}
+	ph.subMu.Lock()
+	defer ph.subMu.Unlock()
+	if ph.subs == nil {
+		// PHOS has been closed
+		close(sub.c)
+		return sub.c
+	}
+	ph.subs[sub.c] = sub
+	return sub.c
+}
+
+// Unsubscribe closes the channel returned by Subscribe and stops delivering results to it
+// Note: The delivery blocked by the subscriber will be canceled
+func (ph *Phos[T]) Unsubscribe(c <-chan Result[T]) {
+	ph.subMu.Lock()
+	sub, ok := ph.subs[c]
+	delete(ph.subs, c)
+	ph.subMu.Unlock()
+	if ok {
+		sub.close()
+	}
+}
+
+// emit sends the result to Out and delivers it to all subscribers
+// The subscribers with SubscribeBlock receive the result in parallel, so a slow one does not delay the others
+// After Shutdown is aborted, it returns false and drops the result if Out or the subscriber is not ready to receive it
+func (ph *Phos[T]) emit(res Result[T]) bool {
+	select {
+	case ph.out <- res:
+	case <-ph.abortC:
+		// Note: the result is still delivered if Out is being read
+		select {
+		case ph.out <- res:
+		default:
+			return false
+		}
+	}
+	ph.subMu.Lock()
+	subs := make([]*subscriber[T], 0, len(ph.subs))
+	for _, sub := range ph.subs {
+		subs = append(subs, sub)
+	}
+	ph.subMu.Unlock()
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		if sub.policy != SubscribeBlock {
+			if !sub.deliver(res, ph.abortC) {
+				ph.Unsubscribe(sub.c)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(sub *subscriber[T]) {
+			defer wg.Done()
+			sub.deliver(res, ph.abortC)
+		}(sub)
+	}
+	wg.Wait()
+	return true
+}
+
+// closeSubscribers closes all subscriber channels, Subscribe will return a closed channel afterwards
+func (ph *Phos[T]) closeSubscribers() {
+	ph.subMu.Lock()
+	subs := ph.subs
+	ph.subs = nil
+	ph.subMu.Unlock()
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
+// close cancels the delivery and closes the channel of the subscriber
+func (s *subscriber[T]) close() {
+	s.once.Do(func() {
+		close(s.doneC)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		close(s.c)
+	})
+}
+
+// deliver returns false if the subscriber should be disconnected, the blocked delivery is canceled when abortC is closed
+func (s *subscriber[T]) deliver(res Result[T], abortC <-chan struct{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.doneC:
+		return true
+	default:
+	}
+	if s.policy == SubscribeBlock {
+		select {
+		case s.c <- res:
+		case <-s.doneC:
+		case <-abortC:
+		}
+		return true
+	}
+	select {
+	case s.c <- res:
+		return true
+	default:
+	}
+	switch s.policy {
+	case SubscribeDropOldest:
+		select {
+		case <-s.c:
+		default:
+		}
+		select {
+		case s.c <- res:
+		default:
+		}
+	case SubscribeDisconnect:
+		return false
+	}
+	// SubscribeDropNewest
+	return true
+}
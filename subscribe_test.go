@@ -0,0 +1,102 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestSubscribe(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	sub1 := ph.Subscribe()
+	sub2 := ph.Subscribe(WithSubscribeBuffer(1))
+	ph.In <- 10 // 10 + 1 = 11
+	res := <-ph.Out
+	assert.Equal(t, 11, res.Data)
+	res1 := <-sub1
+	res2 := <-sub2
+	assert.Equal(t, 11, res1.Data)
+	assert.Equal(t, 11, res2.Data)
+	ph.Unsubscribe(sub2)
+	_, ok := <-sub2
+	assert.False(t, ok)
+	ph.Close()
+	<-ph.Out
+	res1 = <-sub1
+	assert.False(t, res1.OK)
+	_, ok = <-sub1
+	assert.False(t, ok)
+	_, ok = <-ph.Subscribe()
+	assert.False(t, ok)
+}
+
+func TestSubscribePolicy(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	oldest := ph.Subscribe(WithSubscribeBuffer(1), WithSubscribePolicy(SubscribeDropOldest))
+	newest := ph.Subscribe(WithSubscribeBuffer(1), WithSubscribePolicy(SubscribeDropNewest))
+	disconnect := ph.Subscribe(WithSubscribeBuffer(1), WithSubscribePolicy(SubscribeDisconnect))
+	ph.In <- 10
+	<-ph.Out
+	ph.In <- 20
+	<-ph.Out
+	assert.Equal(t, 21, (<-oldest).Data)
+	assert.Equal(t, 11, (<-newest).Data)
+	assert.Equal(t, 11, (<-disconnect).Data)
+	_, ok := <-disconnect
+	assert.False(t, ok)
+	ph.Close()
+	<-ph.Out
+}
+
+func TestUnsubscribeBlocked(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	ph.Append(plusOne)
+	blocked := ph.Subscribe(WithSubscribeBuffer(1))
+	other := ph.Subscribe(WithSubscribeBuffer(4))
+	// Note:
+	// The delivery of the second result is blocked by the subscriber which stops reading,
+	// the other subscriber still receives it
+	for i := 0; i < 2; i++ {
+		ph.In <- i
+		<-ph.Out
+	}
+	assert.Equal(t, 1, (<-other).Data)
+	assert.Equal(t, 2, (<-other).Data)
+	done := make(chan struct{})
+	go func() {
+		ph.Unsubscribe(blocked)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe is blocked by the delivery")
+	}
+	ph.In <- 2
+	assert.Equal(t, 3, (<-ph.Out).Data)
+	assert.Equal(t, 3, (<-other).Data)
+	ph.Close()
+	<-ph.Out
+}
@@ -0,0 +1,370 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	walAppend byte = iota + 1
+	walDone
+)
+
+const (
+	walExt = ".wal"
+	// walHeaderSize is the size of the length and the checksum of a record
+	walHeaderSize = 8
+	// walBodySize is the size of the type and the sequence number of a record
+	walBodySize = 9
+)
+
+// walSegmentSize is the size after which a new segment file will be created
+var walSegmentSize int64 = 4 << 20
+
+// Codec serializes the data of PHOS for the WAL
+type Codec[T any] interface {
+	Marshal(data T) ([]byte, error)
+	Unmarshal(b []byte) (T, error)
+}
+
+// JSONCodec is a Codec using encoding/json
+type JSONCodec[T any] struct{}
+
+// Marshal data to JSON
+func (JSONCodec[T]) Marshal(data T) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+// Unmarshal data from JSON
+func (JSONCodec[T]) Unmarshal(b []byte) (T, error) {
+	var data T
+	err := json.Unmarshal(b, &data)
+	return data, err
+}
+
+// WAL is a write-ahead log of the data accepted by PHOS
+// Every record is appended to the segment files under the directory with a CRC32 checksum,
+// the data is persisted before handling and marked done after its result is consumed and acknowledged by Ack,
+// so the unfinished data can be replayed by a new PHOS after a crash (at-least-once)
+// Note: A torn record at the end of the last segment file is ignored, OpenWAL returns ErrCorrupt for a bad record elsewhere
+type WAL[T any] struct {
+	dir   string
+	codec Codec[T]
+
+	mu      sync.Mutex
+	file    *os.File
+	segment uint64
+	size    int64
+	seq     uint64
+	// live maps the sequence number of the unfinished data to its segment
+	live map[uint64]uint64
+	// counts is the number of the unfinished data of each segment
+	counts   map[uint64]int
+	segments []uint64
+	replay   []walEntry[T]
+	closed   bool
+}
+
+type walEntry[T any] struct {
+	seq  uint64
+	data T
+}
+
+// OpenWAL opens the WAL under dir, the directory will be created if it does not exist
+// The unfinished data found in dir will be replayed by the PHOS created WithWAL
+func OpenWAL[T any](dir string, codec Codec[T]) (*WAL[T], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	w := &WAL[T]{
+		dir:    dir,
+		codec:  codec,
+		live:   make(map[uint64]uint64),
+		counts: make(map[uint64]int),
+	}
+	old, err := w.list()
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[uint64][]byte)
+	for i, id := range old {
+		if err = w.read(id, i == len(old)-1, pending); err != nil {
+			return nil, err
+		}
+		w.segment = id
+	}
+	seqs := make([]uint64, 0, len(pending))
+	for seq := range pending {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	for _, seq := range seqs {
+		data, err := codec.Unmarshal(pending[seq])
+		if err != nil {
+			return nil, fmt.Errorf("phos error wal decode seq %d: %w", seq, err)
+		}
+		w.replay = append(w.replay, walEntry[T]{seq: seq, data: data})
+	}
+	// Note: the unfinished data is compacted into a new segment, then the old segments can be removed
+	if err = w.roll(); err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		if err = w.write(walAppend, seq, pending[seq]); err != nil {
+			_ = w.file.Close()
+			return nil, err
+		}
+		w.track(seq)
+	}
+	if err = w.file.Sync(); err != nil {
+		_ = w.file.Close()
+		return nil, err
+	}
+	for _, id := range old {
+		if err = os.Remove(w.path(id)); err != nil {
+			_ = w.file.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Pending returns the number of the unfinished data in the WAL
+func (w *WAL[T]) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.live)
+}
+
+// Close the WAL, PHOS will close its WAL when it is closed
+func (w *WAL[T]) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.file.Close()
+}
+
+// append persists data and returns its sequence number
+func (w *WAL[T]) append(data T) (uint64, error) {
+	payload, err := w.codec.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	seq := w.seq + 1
+	if err = w.write(walAppend, seq, payload); err != nil {
+		return 0, err
+	}
+	if err = w.file.Sync(); err != nil {
+		return 0, err
+	}
+	w.seq = seq
+	w.track(seq)
+	if w.size >= walSegmentSize {
+		return seq, w.roll()
+	}
+	return seq, nil
+}
+
+// done marks the data of seq finished, the segments without unfinished data will be removed
+// Note: The done record is not synced, losing it only causes the data to be replayed again
+func (w *WAL[T]) done(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	segment, ok := w.live[seq]
+	if !ok || w.closed {
+		return nil
+	}
+	if err := w.write(walDone, seq, nil); err != nil {
+		return err
+	}
+	delete(w.live, seq)
+	w.counts[segment]--
+	return w.compact()
+}
+
+// advance makes the following sequence numbers greater than seq
+func (w *WAL[T]) advance(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq = max(w.seq, seq)
+}
+
+// entries returns the unfinished data found by OpenWAL, it returns nil after the first call
+func (w *WAL[T]) entries() []walEntry[T] {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entries := w.replay
+	w.replay = nil
+	return entries
+}
+
+func (w *WAL[T]) track(seq uint64) {
+	w.live[seq] = w.segment
+	w.counts[w.segment]++
+	if seq > w.seq {
+		w.seq = seq
+	}
+}
+
+// compact removes the oldest segments without unfinished data
+// Note: A segment is removed only after all the older ones, because the done records of its data may be in the newer segments
+func (w *WAL[T]) compact() error {
+	for len(w.segments) > 0 && w.segments[0] != w.segment && w.counts[w.segments[0]] == 0 {
+		id := w.segments[0]
+		if err := os.Remove(w.path(id)); err != nil {
+			return err
+		}
+		delete(w.counts, id)
+		w.segments = w.segments[1:]
+	}
+	return nil
+}
+
+// roll creates a new segment for the following records
+func (w *WAL[T]) roll() error {
+	id := w.segment + 1
+	file, err := os.OpenFile(w.path(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if w.file != nil {
+		if err = w.file.Close(); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	w.file, w.segment, w.size = file, id, 0
+	w.segments = append(w.segments, id)
+	return w.compact()
+}
+
+func (w *WAL[T]) write(typ byte, seq uint64, payload []byte) error {
+	record := make([]byte, walHeaderSize+walBodySize+len(payload))
+	body := record[walHeaderSize:]
+	body[0] = typ
+	binary.BigEndian.PutUint64(body[1:], seq)
+	copy(body[walBodySize:], payload)
+	binary.BigEndian.PutUint32(record, uint32(len(body)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(body))
+	n, err := w.file.Write(record)
+	w.size += int64(n)
+	return err
+}
+
+// read collects the payloads of the unfinished data of the segment into pending
+// A torn record is tolerated only at the end of the last segment, ErrCorrupt is returned for a bad record elsewhere
+func (w *WAL[T]) read(id uint64, last bool, pending map[uint64][]byte) error {
+	file, err := os.Open(w.path(id))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(file)
+	header := make([]byte, walHeaderSize)
+	var offset int64
+	for offset < info.Size() {
+		// torn reports whether the bad record may be the last one interrupted by a crash
+		torn := func(end int64) error {
+			if last && end >= info.Size() {
+				return nil
+			}
+			return fmt.Errorf("%w: segment %d offset %d", ErrCorrupt, id, offset)
+		}
+		if _, err = io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return torn(info.Size())
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		end := offset + walHeaderSize + size
+		if size < walBodySize || end > info.Size() {
+			return torn(end)
+		}
+		body := make([]byte, size)
+		if _, err = io.ReadFull(r, body); err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:]) {
+			return torn(end)
+		}
+		seq := binary.BigEndian.Uint64(body[1:])
+		if seq > w.seq {
+			w.seq = seq
+		}
+		switch body[0] {
+		case walAppend:
+			pending[seq] = body[walBodySize:]
+		case walDone:
+			delete(pending, seq)
+		default:
+			return fmt.Errorf("%w: segment %d offset %d", ErrCorrupt, id, offset)
+		}
+		offset = end
+	}
+	return nil
+}
+
+// list returns the ids of the segments in order
+func (w *WAL[T]) list() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), walExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (w *WAL[T]) path(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", id, walExt))
+}
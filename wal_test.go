@@ -0,0 +1,193 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestWALReplay(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	dir := t.TempDir()
+	wal, err := OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	// Note:
+	// Simulate a crash after the data 1, 2, 3 are accepted and the data 2 is done
+	for i := 1; i <= 3; i++ {
+		_, err = wal.append(i)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, wal.done(2))
+	assert.Nil(t, wal.Close())
+
+	wal, err = OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, wal.Pending())
+	ph := New[int](WithWAL(wal), WithQueueSize(4))
+	ph.Append(plusOne)
+	// Note:
+	// The results are acknowledged before Close, otherwise they will be replayed again
+	for _, data := range []int{2, 4} {
+		res := <-ph.Out
+		assert.Equal(t, data, res.Data)
+		res.Ack()
+	}
+	go ph.Close()
+	assert.Empty(t, collect(ph))
+
+	wal, err = OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	assert.Zero(t, wal.Pending())
+	assert.Nil(t, wal.Close())
+}
+
+func TestWALUnacked(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	dir := t.TempDir()
+	wal, err := OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	ph := New[int](WithWAL(wal))
+	ph.Append(plusOne)
+	ph.In <- 1
+	ph.In <- 2
+	(<-ph.Out).Ack()
+	// Note:
+	// The result of the data 2 is received but not acknowledged, it will be replayed after restart
+	assert.Equal(t, 3, (<-ph.Out).Data)
+	go ph.Close()
+	<-ph.Out
+
+	wal, err = OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, wal.Pending())
+	assert.Nil(t, wal.Close())
+}
+
+func TestWALSend(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	dir := t.TempDir()
+	wal, err := OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	ph := New[int](WithWAL(wal), WithTimeout(50*time.Millisecond))
+	ph.Append(plusOneWithCtxSleep)
+	assert.Nil(t, ph.SendContext(context.Background(), 1))
+	ph.In <- 2
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		for res := range ph.Out {
+			if !res.OK {
+				return
+			}
+		}
+	}()
+	// Note:
+	// The abandoned data is not done, it will be replayed after restart
+	err = ph.Shutdown(ctx)
+	assert.NotNil(t, err)
+
+	wal, err = OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, wal.Pending())
+	assert.Nil(t, wal.Close())
+}
+
+func TestWALTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := OpenWAL[string](dir, JSONCodec[string]{})
+	assert.Nil(t, err)
+	_, err = wal.append("a")
+	assert.Nil(t, err)
+	_, err = wal.append("b")
+	assert.Nil(t, err)
+	assert.Nil(t, wal.Close())
+	// Note:
+	// Cut the last record in half
+	path := wal.path(wal.segment)
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(path, info.Size()-2))
+
+	wal, err = OpenWAL[string](dir, JSONCodec[string]{})
+	assert.Nil(t, err)
+	entries := wal.entries()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "a", entries[0].data)
+	seq, err := wal.append("c")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), seq)
+	assert.Nil(t, wal.Close())
+}
+
+func TestWALCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	for i := 1; i <= 5; i++ {
+		_, err = wal.append(i)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, wal.Close())
+	// Note:
+	// Flip a byte of the payload of the second record
+	path := wal.path(wal.segment)
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	record := len(b) / 5
+	b[record+walHeaderSize+walBodySize] ^= 0xff
+	assert.Nil(t, os.WriteFile(path, b, 0o644))
+
+	_, err = OpenWAL[int](dir, JSONCodec[int]{})
+	assert.ErrorIs(t, err, ErrCorrupt)
+	// Note:
+	// The segment is kept for recovery
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+}
+
+func TestWALSegments(t *testing.T) {
+	size := walSegmentSize
+	walSegmentSize = 1
+	defer func() {
+		walSegmentSize = size
+	}()
+	dir := t.TempDir()
+	wal, err := OpenWAL[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	for i := 1; i <= 3; i++ {
+		_, err = wal.append(i)
+		assert.Nil(t, err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+walExt))
+	assert.Len(t, segments, 4)
+	// Note:
+	// The segment of the data 2 is kept until the segment of the data 1 is removed
+	assert.Nil(t, wal.done(2))
+	segments, _ = filepath.Glob(filepath.Join(dir, "*"+walExt))
+	assert.Len(t, segments, 4)
+	assert.Nil(t, wal.done(1))
+	assert.Nil(t, wal.done(3))
+	segments, _ = filepath.Glob(filepath.Join(dir, "*"+walExt))
+	assert.Len(t, segments, 1)
+	assert.Nil(t, wal.Close())
+}
@@ -0,0 +1,447 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type windowKind uint64
+
+const (
+	tumbling windowKind = iota
+	sliding
+	session
+)
+
+// ReduceFunc aggregates data into acc, acc is the first data of the window at the beginning
+type ReduceFunc[T any] func(acc, data T) T
+
+// EventTimeFunc returns the event time of data
+type EventTimeFunc func(data any) time.Time
+
+// WindowOption for Window
+type WindowOption func(o *WindowOptions)
+
+// WindowOptions for Window
+type WindowOptions struct {
+	EventTime       EventTimeFunc
+	AllowedLateness time.Duration
+}
+
+// WithEventTime will make Window collect data by event time instead of processing time
+// The windows will be fired when the watermark (the max event time seen) passes the end of the windows
+func WithEventTime(fn EventTimeFunc) WindowOption {
+	return func(o *WindowOptions) {
+		o.EventTime = fn
+	}
+}
+
+// WithAllowedLateness will delay the firing of event time windows to accept late data,
+// the data later than that will be dropped and counted by Late
+func WithAllowedLateness(lateness time.Duration) WindowOption {
+	return func(o *WindowOptions) {
+		o.AllowedLateness = lateness
+	}
+}
+
+// Window is a stage of the handler chain which aggregates data into windows,
+// the aggregated data of each window will be handled by the rest of the handler chain when the window is fired
+// The open windows will be fired when PHOS is closed
+// Note: The data collected by Window will not be delivered to Out,
+// and Window should not be used in a PHOS nested by AsHandler
+// Window implements Stage, the open windows will be saved in the checkpoint if it is set by WithStage
+type Window[T any] struct {
+	kind    windowKind
+	size    time.Duration
+	slide   time.Duration
+	reduce  ReduceFunc[T]
+	options *WindowOptions
+
+	mu        sync.Mutex
+	panes     map[string][]*pane[T]
+	watermark time.Time
+	// firing is the fired windows whose aggregated data has not been handled yet
+	firing map[*pane[T]]struct{}
+	ph     *Phos[T]
+	late   atomic.Uint64
+}
+
+type pane[T any] struct {
+	key   string
+	start time.Time
+	end   time.Time
+	acc   T
+	timer *time.Timer
+	// index and version are the position of Window in the handler chain when the pane is created
+	index   int
+	version uint64
+}
+
+type chainKey struct{}
+
+// chainInfo is the position of the running handler in the handler chain
+type chainInfo[T any] struct {
+	ph      *Phos[T]
+	index   int
+	version uint64
+}
+
+var errNotInChain = errors.New("phos error window is not in handler chain")
+
+// TumblingWindow collects data into fixed size, non-overlapping windows
+// Note: It panics if size is not positive
+func TumblingWindow[T any](size time.Duration, reduce ReduceFunc[T], opts ...WindowOption) *Window[T] {
+	if size <= 0 {
+		panic("phos: TumblingWindow requires positive size")
+	}
+	return newWindow(tumbling, size, size, reduce, opts...)
+}
+
+// SlidingWindow collects data into fixed size windows which start every slide,
+// a data belongs to multiple windows if slide < size
+// Note: It panics unless 0 < slide <= size
+func SlidingWindow[T any](size, slide time.Duration, reduce ReduceFunc[T], opts ...WindowOption) *Window[T] {
+	if slide <= 0 || slide > size {
+		panic("phos: SlidingWindow requires 0 < slide <= size")
+	}
+	return newWindow(sliding, size, slide, reduce, opts...)
+}
+
+// SessionWindow collects data into windows which are closed after gap without data (of the same key)
+// Note: It panics if gap is not positive
+func SessionWindow[T any](gap time.Duration, reduce ReduceFunc[T], opts ...WindowOption) *Window[T] {
+	if gap <= 0 {
+		panic("phos: SessionWindow requires positive gap")
+	}
+	return newWindow(session, gap, gap, reduce, opts...)
+}
+
+func newWindow[T any](kind windowKind, size, slide time.Duration, reduce ReduceFunc[T], opts ...WindowOption) *Window[T] {
+	options := &WindowOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &Window[T]{
+		kind:    kind,
+		size:    size,
+		slide:   slide,
+		reduce:  reduce,
+		options: options,
+		panes:   make(map[string][]*pane[T]),
+		firing:  make(map[*pane[T]]struct{}),
+	}
+}
+
+// windowState is the encoded state of Window
+type windowState[T any] struct {
+	Watermark time.Time
+	Panes     []paneState[T]
+}
+
+type paneState[T any] struct {
+	Key   string
+	Start time.Time
+	End   time.Time
+	Acc   T
+	Index int
+}
+
+// SnapshotStage encodes the open windows (including the fired ones not handled yet) as JSON
+func (w *Window[T]) SnapshotStage() ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	state := windowState[T]{
+		Watermark: w.watermark,
+	}
+	add := func(p *pane[T]) {
+		state.Panes = append(state.Panes, paneState[T]{
+			Key:   p.key,
+			Start: p.start,
+			End:   p.end,
+			Acc:   p.acc,
+			Index: p.index,
+		})
+	}
+	for _, panes := range w.panes {
+		for _, p := range panes {
+			add(p)
+		}
+	}
+	for p := range w.firing {
+		add(p)
+	}
+	return json.Marshal(state)
+}
+
+// RestoreStage replaces the open windows with the encoded ones, the fired ones not handled yet will be fired again
+// Note: The windows are restored into the handler chain of the same position
+func (w *Window[T]) RestoreStage(b []byte) error {
+	var state windowState[T]
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, panes := range w.panes {
+		for _, p := range panes {
+			if p.timer != nil {
+				p.timer.Stop()
+			}
+		}
+	}
+	w.panes = make(map[string][]*pane[T])
+	w.firing = make(map[*pane[T]]struct{})
+	w.watermark = state.Watermark
+	for _, ps := range state.Panes {
+		p := &pane[T]{
+			key:   ps.Key,
+			start: ps.Start,
+			end:   ps.End,
+			acc:   ps.Acc,
+			index: ps.Index,
+		}
+		if w.ph != nil {
+			w.schedule(p)
+		}
+		w.panes[p.key] = append(w.panes[p.key], p)
+	}
+	return nil
+}
+
+// bind Window to PHOS before the data is handled, so that the restored windows can be fired
+func (w *Window[T]) bind(ph *Phos[T]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ph != nil {
+		return
+	}
+	w.ph = ph
+	ph.addFlusher(w.flush)
+	for _, panes := range w.panes {
+		for _, p := range panes {
+			w.schedule(p)
+		}
+	}
+	if w.options.EventTime != nil {
+		// Note: the restored windows fired before the checkpoint are fired again
+		w.fireUntil(w.watermark.Add(-w.options.AllowedLateness))
+	}
+}
+
+// Late returns the number of data dropped because their windows have been fired
+func (w *Window[T]) Late() uint64 {
+	return w.late.Load()
+}
+
+// Handler returns the Handler of Window to be appended to PHOS
+// The windows are separated by key if keyed partitioning (WithKeyFunc) is enabled
+func (w *Window[T]) Handler() Handler[T] {
+	return func(ctx context.Context, data T) (T, error) {
+		info, ok := ctx.Value(chainKey{}).(*chainInfo[T])
+		if !ok {
+			return data, errNotInChain
+		}
+		var key string
+		if state, ok := StateFrom(ctx).(*keyedState); ok {
+			key = state.key
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.ph == nil {
+			w.ph = info.ph
+			info.ph.addFlusher(w.flush)
+		}
+		t := time.Now()
+		if w.options.EventTime != nil {
+			t = w.options.EventTime(data)
+			if t.After(w.watermark) {
+				w.watermark = t
+			}
+		}
+		if !w.add(info, key, t, data) {
+			w.late.Add(1)
+		}
+		if w.options.EventTime != nil {
+			w.fireUntil(w.watermark.Add(-w.options.AllowedLateness))
+		}
+		return data, ErrSkip
+	}
+}
+
+// add data to the windows it belongs to, it returns false if all the windows have been fired
+func (w *Window[T]) add(info *chainInfo[T], key string, t time.Time, data T) bool {
+	switch w.kind {
+	case session:
+		return w.addSession(info, key, t, data)
+	default:
+		added := false
+		for start := t.Truncate(w.slide); start.Add(w.size).After(t); start = start.Add(-w.slide) {
+			if w.addPane(info, key, start, start.Add(w.size), data) {
+				added = true
+			}
+		}
+		return added
+	}
+}
+
+func (w *Window[T]) addPane(info *chainInfo[T], key string, start, end time.Time, data T) bool {
+	for _, p := range w.panes[key] {
+		if p.start.Equal(start) {
+			p.acc = w.reduce(p.acc, data)
+			return true
+		}
+	}
+	if w.fired(end) {
+		return false
+	}
+	p := &pane[T]{
+		key:     key,
+		start:   start,
+		end:     end,
+		acc:     data,
+		index:   info.index,
+		version: info.version,
+	}
+	w.schedule(p)
+	w.panes[key] = append(w.panes[key], p)
+	return true
+}
+
+// addSession merges the new session [t, t+gap) with the overlapping sessions
+func (w *Window[T]) addSession(info *chainInfo[T], key string, t time.Time, data T) bool {
+	merged := &pane[T]{
+		key:     key,
+		start:   t,
+		end:     t.Add(w.size),
+		acc:     data,
+		index:   info.index,
+		version: info.version,
+	}
+	if w.fired(merged.end) {
+		return false
+	}
+	panes := w.panes[key][:0]
+	for _, p := range w.panes[key] {
+		if p.start.After(merged.end) || !p.end.After(merged.start) {
+			panes = append(panes, p)
+			continue
+		}
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		if p.start.Before(merged.start) {
+			merged.start = p.start
+			merged.acc = w.reduce(p.acc, merged.acc)
+		} else {
+			merged.acc = w.reduce(merged.acc, p.acc)
+		}
+		if p.end.After(merged.end) {
+			merged.end = p.end
+		}
+	}
+	w.schedule(merged)
+	w.panes[key] = append(panes, merged)
+	return true
+}
+
+// fired reports whether the event time window ending at end has been fired
+func (w *Window[T]) fired(end time.Time) bool {
+	if w.options.EventTime == nil {
+		return false
+	}
+	return !end.After(w.watermark.Add(-w.options.AllowedLateness))
+}
+
+// schedule fires the processing time window when it ends
+func (w *Window[T]) schedule(p *pane[T]) {
+	if w.options.EventTime != nil {
+		return
+	}
+	p.timer = time.AfterFunc(time.Until(p.end), func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if i := slices.Index(w.panes[p.key], p); i >= 0 {
+			w.panes[p.key] = slices.Delete(w.panes[p.key], i, i+1)
+			if len(w.panes[p.key]) == 0 {
+				delete(w.panes, p.key)
+			}
+			w.inject(p)
+		}
+	})
+}
+
+// inject the aggregated data of the fired window, it is kept in firing until the data is handled
+func (w *Window[T]) inject(p *pane[T]) {
+	w.firing[p] = struct{}{}
+	w.ph.inject(p.acc, p.index+1, p.version, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.firing, p)
+	})
+}
+
+// fireUntil fires the windows ending before the time in order of their end
+func (w *Window[T]) fireUntil(t time.Time) {
+	var fired []*pane[T]
+	for key, panes := range w.panes {
+		remain := panes[:0]
+		for _, p := range panes {
+			if p.end.After(t) {
+				remain = append(remain, p)
+				continue
+			}
+			fired = append(fired, p)
+		}
+		if len(remain) == 0 {
+			delete(w.panes, key)
+			continue
+		}
+		w.panes[key] = remain
+	}
+	w.fire(fired)
+}
+
+// flush fires all the open windows
+func (w *Window[T]) flush() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var fired []*pane[T]
+	for _, panes := range w.panes {
+		fired = append(fired, panes...)
+	}
+	w.panes = make(map[string][]*pane[T])
+	w.fire(fired)
+	return len(fired) > 0
+}
+
+func (w *Window[T]) fire(panes []*pane[T]) {
+	slices.SortStableFunc(panes, func(a, b *pane[T]) int {
+		return a.end.Compare(b.end)
+	})
+	for _, p := range panes {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		w.inject(p)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 BINARY Members
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except In compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to In writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package phos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// Note:
+// The data of the window tests is the event time in seconds
+func seconds(data any) time.Time {
+	return time.Unix(int64(data.(int)), 0)
+}
+
+func sum(acc, data int) int {
+	return acc + data
+}
+
+func collect(ph *Phos[int]) []int {
+	var data []int
+	for res := range ph.Out {
+		if !res.OK {
+			break
+		}
+		data = append(data, res.Data)
+	}
+	return data
+}
+
+func TestTumblingWindow(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(8))
+	w := TumblingWindow[int](10*time.Second, sum, WithEventTime(seconds))
+	ph.Append(plusOne, w.Handler(), plusThree)
+	// Note:
+	// The data is increased by one before the window: [1, 3] [11, 13] [21]
+	for _, data := range []int{0, 2, 10, 12, 20} {
+		ph.In <- data
+	}
+	go ph.Close()
+	// [1, 3] and [11, 13] are fired by the watermark, [21] is fired by Close
+	assert.Equal(t, []int{1 + 3 + 3, 11 + 13 + 3, 21 + 3}, collect(ph))
+}
+
+func TestSlidingWindow(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(8))
+	w := SlidingWindow[int](10*time.Second, 5*time.Second, sum, WithEventTime(seconds))
+	ph.Append(w.Handler())
+	for _, data := range []int{1, 6, 11} {
+		ph.In <- data
+	}
+	go ph.Close()
+	// [-5, 5): 1, [0, 10): 1 + 6, [5, 15): 6 + 11, [10, 20): 11
+	assert.Equal(t, []int{1, 7, 17, 11}, collect(ph))
+}
+
+func TestSessionWindow(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(8))
+	w := SessionWindow[int](5*time.Second, sum, WithEventTime(seconds))
+	ph.Append(w.Handler())
+	for _, data := range []int{1, 3, 20, 22, 4} {
+		ph.In <- data
+	}
+	go ph.Close()
+	// Note:
+	// The data 4 is late because the session [1, 8) has been fired when 20 arrived
+	assert.Equal(t, []int{1 + 3, 20 + 22}, collect(ph))
+	assert.Equal(t, uint64(1), w.Late())
+}
+
+func TestWindowAllowedLateness(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(8))
+	w := TumblingWindow[int](10*time.Second, sum, WithEventTime(seconds), WithAllowedLateness(5*time.Second))
+	ph.Append(w.Handler())
+	for _, data := range []int{1, 12, 2, 16, 3} {
+		ph.In <- data
+	}
+	go ph.Close()
+	// Note:
+	// The data 2 is accepted because the watermark 12 has not passed 10 + 5,
+	// and the data 3 is late because the watermark 16 has passed
+	assert.Equal(t, []int{1 + 2, 12 + 16}, collect(ph))
+	assert.Equal(t, uint64(1), w.Late())
+}
+
+func TestProcessingTimeWindow(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int](WithQueueSize(8))
+	defer ph.Close()
+	w := TumblingWindow[int](50*time.Millisecond, sum)
+	ph.Append(w.Handler())
+	for i := 1; i <= 3; i++ {
+		ph.In <- i
+	}
+	total := 0
+	for total < 6 {
+		res := <-ph.Out
+		assert.True(t, res.OK)
+		total += res.Data
+	}
+	assert.Equal(t, 6, total)
+}
+
+func TestWindowChainChanged(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	w := TumblingWindow[int](10*time.Second, sum, WithEventTime(seconds))
+	ph.Append(w.Handler(), plusOne, plusThree)
+	ph.In <- 1
+	ph.In <- 2
+	assert.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.panes[""]) == 1 && w.panes[""][0].acc == 3
+	}, time.Second, time.Millisecond)
+	// Note:
+	// The window [1, 2] is opened before Delete, it will not be fired into the changed handler chain
+	ph.Delete(1)
+	go ph.Close()
+	res := <-ph.Out
+	assert.Equal(t, 3, res.Data)
+	assert.ErrorIs(t, res.Err, ErrChainChanged)
+	assert.Equal(t, HandlerErr, res.Err.Type)
+	assert.False(t, (<-ph.Out).OK)
+}
+
+func TestWindowSnapshotFiring(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	ph := New[int]()
+	w := TumblingWindow[int](10*time.Second, sum, WithEventTime(seconds))
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	ph.Append(w.Handler(), func(_ context.Context, data int) (int, error) {
+		started <- struct{}{}
+		<-release
+		return data, nil
+	})
+	ph.In <- 1
+	ph.In <- 15
+	<-started
+	// Note:
+	// The window [1] has been fired but not handled yet, so it is still in the snapshot
+	b, err := w.SnapshotStage()
+	assert.Nil(t, err)
+	w2 := TumblingWindow[int](10*time.Second, sum, WithEventTime(seconds))
+	assert.Nil(t, w2.RestoreStage(b))
+	assert.Len(t, w2.panes[""], 2)
+	close(release)
+	assert.Equal(t, 1, (<-ph.Out).Data)
+	assert.Eventually(t, func() bool {
+		b, err = w.SnapshotStage()
+		assert.Nil(t, err)
+		assert.Nil(t, w2.RestoreStage(b))
+		return len(w2.panes[""]) == 1 && w2.panes[""][0].acc == 15
+	}, time.Second, time.Millisecond)
+	go ph.Close()
+	<-started
+	assert.Equal(t, 15, (<-ph.Out).Data)
+	assert.False(t, (<-ph.Out).OK)
+}
+
+func TestWindowNotInChain(t *testing.T) {
+	w := TumblingWindow[int](time.Second, sum)
+	_, err := w.Handler()(context.Background(), 1)
+	assert.ErrorIs(t, err, errNotInChain)
+}
+
+func TestWindowInvalid(t *testing.T) {
+	assert.Panics(t, func() { TumblingWindow[int](0, sum) })
+	assert.Panics(t, func() { SlidingWindow[int](time.Second, 0, sum) })
+	assert.Panics(t, func() { SlidingWindow[int](time.Second, 2*time.Second, sum) })
+	assert.Panics(t, func() { SessionWindow[int](-time.Second, sum) })
+	assert.NotPanics(t, func() { SlidingWindow[int](time.Second, time.Second, sum) })
+}